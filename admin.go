@@ -0,0 +1,47 @@
+package needforheatmanualserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+)
+
+var (
+	ErrAdminDisabled     = errors.New("admin endpoints are disabled, because no admin token is set")
+	ErrAdminUnauthorized = errors.New("missing or invalid admin token")
+)
+
+// Middleware that only lets requests through that have the admin token as bearer token.
+//
+// When no admin token is set, admin endpoints do not exist.
+func (s *Server) adminMiddleware(next Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if s.options.AdminToken == "" {
+			return NewHandlerError(ErrAdminDisabled, http.StatusNotFound)
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.options.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			return NewHandlerError(ErrAdminUnauthorized, http.StatusUnauthorized)
+		}
+
+		return next(w, r)
+	}
+}
+
+// Handle serving the build report of the manuals that are currently served.
+func (s *Server) handleBuildReport(w http.ResponseWriter, r *http.Request) error {
+	file, err := fs.ReadFile(s.FS(), parser.BuildReportFileName)
+	if err != nil {
+		return NewHandlerError(err, http.StatusNotFound)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(file)
+	return nil
+}
@@ -0,0 +1,61 @@
+package needforheatmanualserver
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+)
+
+// Handle serving the catalog of all manuals.
+func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) error {
+	catalog, err := s.readCatalog()
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, catalog)
+}
+
+// Return a handler that serves a single section of the catalog.
+// section selects the section from the catalog.
+func (s *Server) handleCatalogSection(section func(parser.Catalog) any) Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		catalog, err := s.readCatalog()
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(w, section(catalog))
+	}
+}
+
+// Read the catalog from the current filesystem.
+func (s *Server) readCatalog() (parser.Catalog, error) {
+	var catalog parser.Catalog
+
+	data, err := fs.ReadFile(s.FS(), parser.CatalogFileName)
+	if err != nil {
+		return catalog, NewHandlerError(err, http.StatusNotFound)
+	}
+
+	err = json.Unmarshal(data, &catalog)
+	if err != nil {
+		return catalog, NewHandlerError(err, http.StatusInternalServerError)
+	}
+
+	return catalog, nil
+}
+
+// Send v to the HTTP client as JSON.
+func writeJSON(w http.ResponseWriter, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return NewHandlerError(err, http.StatusInternalServerError)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return nil
+}
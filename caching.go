@@ -0,0 +1,90 @@
+package needforheatmanualserver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+)
+
+// CacheControl sets the Cache-Control header of responses by kind of response.
+// The header is not sent for a kind that is empty.
+type CacheControl struct {
+	// Redirects to a language, the generic campaign or the manufacturer manual.
+	Redirects string
+
+	// Manuals and other files, which can change when manuals are reloaded.
+	// They have an ETag, so clients can check if they changed.
+	Files string
+
+	// Content-hashed assets, whose name changes when their contents change.
+	HashedAssets string
+}
+
+// DefaultCacheControl is used when ServerOptions.CacheControl is nil.
+var DefaultCacheControl = CacheControl{
+	Redirects:    "public, max-age=300",
+	Files:        "public, no-cache",
+	HashedAssets: immutableCacheControl,
+}
+
+// Return the Cache-Control headers the server uses.
+func (s *Server) cacheControl() CacheControl {
+	if s.options.CacheControl == nil {
+		return DefaultCacheControl
+	}
+
+	return *s.options.CacheControl
+}
+
+// Set the Cache-Control header of w to value, unless value is empty.
+func setCacheControl(w http.ResponseWriter, value string) {
+	if value != "" {
+		w.Header().Set("Cache-Control", value)
+	}
+}
+
+// Redirect the client to url with the Cache-Control header for redirects.
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, url string) {
+	setCacheControl(w, s.cacheControl().Redirects)
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Read the manifest of the generation in fsys.
+// Returns nil if it cannot be read, so files are served without an ETag.
+func readManifest(fsys fs.FS) parser.Manifest {
+	manifest, err := parser.ReadManifest(fsys)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Println("error reading manifest:", err)
+	}
+
+	return manifest
+}
+
+// Serve the file at filePath in fsys, with the ETag and Last-Modified headers from its entry in the manifest.
+// Requests with an If-None-Match or If-Modified-Since header get a 304 Not Modified response if the file did not change.
+func serveManifestFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, filePath string, file parser.ManifestFile) error {
+	f, err := fsys.Open(filePath)
+	if err != nil {
+		return NewHandlerError(err, http.StatusNotFound)
+	}
+	defer f.Close()
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return NewHandlerError(err, http.StatusInternalServerError)
+		}
+		content = bytes.NewReader(data)
+	}
+
+	w.Header().Set("ETag", file.ETag())
+	http.ServeContent(w, r, path.Base(filePath), file.Modified, content)
+	return nil
+}
@@ -0,0 +1,171 @@
+// Command build exports the manuals from a manual source as a static site.
+//
+// The static site can be hosted on any static host or bundled into an app to be used offline.
+// The server's redirects are replaced by index.html redirect stubs.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"github.com/energietransitie/needforheat-manual-server/static"
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+	"golang.org/x/text/language"
+)
+
+func main() {
+	source := flag.String("source", getenvDefault("NFH_MANUAL_SOURCE", "./source"), "local directory or git repository to read manuals from")
+	branch := flag.String("branch", os.Getenv("NFH_MANUAL_SOURCE_BRANCH"), "branch of the git repository to use")
+	ref := flag.String("ref", os.Getenv("NFH_MANUAL_SOURCE_REF"), "tag or commit hash of the git repository to use")
+	out := flag.String("out", "./site", "directory to write the static site to; its contents are replaced")
+	force := flag.Bool("force", false, "replace the output directory even if it is not empty and does not contain a previous export")
+	fallbackLang := flag.String("fallback-lang", os.Getenv("NFH_FALLBACK_LANG"), "comma separated languages to use, in order, when none of the browser's languages is available (e.g. nl-NL,en-US)")
+	imageMode := flag.String("image-mode", string(parser.ImageModeFiles), "how to include images: 'files' for separate files, or 'inline' for a single HTML file per manual")
+	imageWidths := flag.String("image-widths", "400,800,1600", "comma separated widths of resized image variants, or 'none' to not process images")
+	jpegQuality := flag.Int("jpeg-quality", 85, "quality of encoded JPEG images, from 1 to 100")
+	convertToJPEG := flag.Bool("convert-to-jpeg", false, "encode PNG images without transparency as JPEG")
+	offline := flag.Bool("offline", false, "do not download remote images; cached images are used and other images keep their URL")
+	allowedHosts := flag.String("remote-allowed-hosts", "", "comma separated hosts remote images can be downloaded from (default all hosts)")
+	markdownExtensions := flag.String("markdown-extensions", os.Getenv("NFH_MARKDOWN_EXTENSIONS"), "comma separated markdown extensions for sources without a markdown.json file: 'admonitions', 'steps' and 'tabs'")
+	gzipLevel := flag.Int("gzip-level", parser.DefaultGzipLevel, "level of precompressed .gz files, from 1 to 9, or -1 to not write them")
+	brotliLevel := flag.Int("brotli-level", parser.DefaultBrotliLevel, "level of precompressed .br files, from 1 to 11, or -1 to not write them")
+	resilient := flag.Bool("resilient", false, "skip manuals that cannot be parsed, instead of stopping at the first error")
+	flag.Parse()
+
+	if *fallbackLang == "" {
+		log.Fatal("fallback language was not set, use -fallback-lang or NFH_FALLBACK_LANG")
+	}
+
+	fallbacks, err := parser.ParseFallbackLanguages(*fallbackLang)
+	if err != nil {
+		log.Fatal("fallback language: ", err)
+	}
+
+	mode, err := parser.ParseImageMode(*imageMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	widths, err := parser.ParseImageWidths(*imageWidths)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	extensions, err := parser.ParseExtensions(*markdownExtensions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	options := parser.Options{
+		ImageMode: mode,
+		Images: parser.ImageOptions{
+			Widths:        widths,
+			JPEGQuality:   *jpegQuality,
+			ConvertToJPEG: *convertToJPEG,
+		},
+		Remote: parser.FetchOptions{
+			Offline: *offline,
+		},
+		Extensions: extensions,
+		Compression: parser.CompressionOptions{
+			GzipLevel:   *gzipLevel,
+			BrotliLevel: *brotliLevel,
+		},
+		Resilient: *resilient,
+	}
+
+	err = options.Compression.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *allowedHosts != "" {
+		options.Remote.AllowedHosts = strings.Split(*allowedHosts, ",")
+	}
+
+	outDir := filepath.Clean(*out)
+
+	err = checkOutDir(outDir, *source, *force)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = build(*source, *branch, *ref, outDir, fallbacks, options)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("exported static site to", outDir)
+}
+
+// Parse the manuals in source and export them as a static site to outDir.
+//
+// The site is exported to a temporary directory next to outDir first, which replaces outDir when the export succeeded.
+func build(source string, branch string, ref string, outDir string, fallbacks []language.Tag, options parser.Options) error {
+	credentials, err := parser.CredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	sourceFS, err := parser.NewSource(source, branch, ref, credentials)
+	if err != nil {
+		return err
+	}
+	defer parser.Close(sourceFS)
+
+	workDir, err := os.MkdirTemp("", "nfh-build-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	options.Credentials = credentials
+	manualParser := parser.New(dirfs.New(workDir), options)
+
+	err = manualParser.Parse(sourceFS)
+	if err != nil {
+		return err
+	}
+
+	site, err := manualParser.Current()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(outDir), 0755)
+	if err != nil {
+		return err
+	}
+
+	exportDir, err := os.MkdirTemp(filepath.Dir(outDir), "."+filepath.Base(outDir)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(exportDir)
+
+	err = os.Chmod(exportDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = static.Export(dirfs.New(exportDir), site, fallbacks)
+	if err != nil {
+		return err
+	}
+
+	return replaceOutDir(exportDir, outDir)
+}
+
+// Get the value of the environment variable named by key, or fallback if it is not set.
+func getenvDefault(key string, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+)
+
+// File written to the root of every export, so a later export knows it can replace the directory.
+const exportMarkerFileName = ".needforheat-static-site"
+
+var (
+	ErrOutDirUnsafe   = errors.New("output directory cannot be replaced")
+	ErrOutDirNotEmpty = errors.New("output directory is not empty and does not contain a previous export, use -force to replace it")
+)
+
+// Return an error if replacing outDir could remove files that are not a previous export:
+// outDir is, contains or is inside a local source, it is or contains the working directory or the home directory,
+// or it is not empty and has no export marker, unless force is set.
+func checkOutDir(outDir string, source string, force bool) error {
+	outDir, err := absPath(outDir)
+	if err != nil {
+		return err
+	}
+
+	protected := map[string]string{}
+
+	if sourceURL, err := parser.ParseSourceURL(source); err == nil && !sourceURL.IsGit() {
+		protected["the manual source"] = source
+	}
+	if wd, err := os.Getwd(); err == nil {
+		protected["the working directory"] = wd
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		protected["the home directory"] = home
+	}
+
+	for name, dir := range protected {
+		dir, err := absPath(dir)
+		if err != nil {
+			return err
+		}
+
+		if containsPath(outDir, dir) {
+			return fmt.Errorf("%w: %s is or contains %s", ErrOutDirUnsafe, outDir, name)
+		}
+	}
+
+	if source, ok := protected["the manual source"]; ok {
+		source, err := absPath(source)
+		if err != nil {
+			return err
+		}
+
+		// Exporting into the source would change the manuals.
+		if containsPath(source, outDir) {
+			return fmt.Errorf("%w: %s is inside the manual source", ErrOutDirUnsafe, outDir)
+		}
+	}
+
+	entries, err := os.ReadDir(outDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 || force {
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(outDir, exportMarkerFileName)); err != nil {
+		return fmt.Errorf("%w: %s", ErrOutDirNotEmpty, outDir)
+	}
+
+	return nil
+}
+
+// Replace outDir with the export in exportDir, which has to be in the same directory as outDir.
+// The previous export is only removed once the new one is in place.
+func replaceOutDir(exportDir string, outDir string) error {
+	err := os.WriteFile(filepath.Join(exportDir, exportMarkerFileName), nil, 0644)
+	if err != nil {
+		return err
+	}
+
+	oldDir := exportDir + ".old"
+
+	err = os.Rename(outDir, oldDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	replaced := err == nil
+
+	err = os.Rename(exportDir, outDir)
+	if err != nil {
+		if !replaced {
+			return err
+		}
+
+		rollbackErr := os.Rename(oldDir, outDir)
+		if rollbackErr != nil {
+			return fmt.Errorf("%w, and the previous export could not be restored from %s: %v", err, oldDir, rollbackErr)
+		}
+		return err
+	}
+
+	if replaced {
+		return os.RemoveAll(oldDir)
+	}
+
+	return nil
+}
+
+// Return the absolute path of filePath, with symbolic links resolved.
+// When filePath does not exist (yet), the symbolic links in the part of it that exists are resolved.
+func absPath(filePath string) (string, error) {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	dir, rest := filePath, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return filePath, nil
+		}
+
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+// Returns if filePath is dir or is inside dir.
+func containsPath(dir string, filePath string) bool {
+	rel, err := filepath.Rel(dir, filePath)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainsPath(t *testing.T) {
+	tests := []struct {
+		dir      string
+		filePath string
+		expected bool
+	}{
+		{"/export", "/export", true},
+		{"/export", "/export/manuals", true},
+		{"/export/", "/export/manuals/../index.html", true},
+		{"/export", "/", false},
+		{"/export", "/export-old", false},
+		{"/export", "/other/export", false},
+		{"/export/manuals", "/export", false},
+		{"/export", "/export/..manuals", true},
+	}
+
+	for _, test := range tests {
+		if containsPath(test.dir, test.filePath) != test.expected {
+			t.Errorf("expected containsPath(%q, %q) to be %t", test.dir, test.filePath, test.expected)
+		}
+	}
+}
+
+func TestCheckOutDir(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	source := filepath.Join(tmpDir, "source")
+	sourceLink := filepath.Join(tmpDir, "source-link")
+	empty := filepath.Join(tmpDir, "empty")
+	notEmpty := filepath.Join(tmpDir, "not-empty")
+	previous := filepath.Join(tmpDir, "previous")
+
+	for _, dir := range []string{source, empty, notEmpty, previous} {
+		err := os.Mkdir(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Symlink(source, sourceLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filePath := range []string{filepath.Join(notEmpty, "index.html"), filepath.Join(previous, exportMarkerFileName)} {
+		err := os.WriteFile(filePath, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		outDir   string
+		source   string
+		force    bool
+		expected error
+	}{
+		{"new directory", filepath.Join(tmpDir, "out"), source, false, nil},
+		{"empty directory", empty, source, false, nil},
+		{"previous export", previous, source, false, nil},
+		{"not empty without marker", notEmpty, source, false, ErrOutDirNotEmpty},
+		{"not empty with force", notEmpty, source, true, nil},
+		{"source", source, source, false, ErrOutDirUnsafe},
+		{"source inside out", tmpDir, source, false, ErrOutDirUnsafe},
+		{"source inside out with force", tmpDir, source, true, ErrOutDirUnsafe},
+		{"out inside source", filepath.Join(source, "out"), source, false, ErrOutDirUnsafe},
+		{"out inside symlinked source", filepath.Join(source, "out"), sourceLink, false, ErrOutDirUnsafe},
+		{"symlinked out inside source", filepath.Join(sourceLink, "out"), source, false, ErrOutDirUnsafe},
+		{"symlinked source", sourceLink, source, false, ErrOutDirUnsafe},
+		{"git source", source, "https://github.com/energietransitie/manuals.git", false, nil},
+		{"working directory", wd, "https://github.com/energietransitie/manuals.git", true, ErrOutDirUnsafe},
+		{"parent of working directory", filepath.Dir(wd), "https://github.com/energietransitie/manuals.git", true, ErrOutDirUnsafe},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkOutDir(test.outDir, test.source, test.force)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestReplaceOutDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	outDir := filepath.Join(tmpDir, "out")
+
+	for i, name := range []string{"first.html", "second.html"} {
+		exportDir, err := os.MkdirTemp(tmpDir, ".out-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(filepath.Join(exportDir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = replaceOutDir(exportDir, outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := os.ReadDir(outDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 2 || entries[0].Name() != exportMarkerFileName || entries[1].Name() != name {
+			t.Errorf("export %d: expected the marker and %s, got %v", i, name, entries)
+		}
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected only the output directory to be left, got %v, %v", entries, err)
+	}
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 )
 
 func main() {
-	req, err := http.NewRequest(http.MethodGet, "http://localhost:8080/healthcheck", nil)
+	address := flag.String("listen-address", getenvDefault("NFH_LISTEN_ADDRESS", ":8080"), "address the server listens on (also NFH_LISTEN_ADDRESS)")
+	healthcheckPath := flag.String("healthcheck-path", getenvDefault("NFH_HEALTHCHECK_PATH", "/healthcheck"), "path of the healthcheck endpoint (also NFH_HEALTHCHECK_PATH)")
+	flag.Parse()
+
+	req, err := http.NewRequest(http.MethodGet, healthcheckURL(*address, *healthcheckPath), nil)
 	if err != nil {
 		fmt.Println("creating request failed")
 		os.Exit(1)
@@ -24,3 +30,28 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// Return the URL of the healthcheck endpoint of a server that listens on address.
+// A server that listens on all interfaces is checked on localhost.
+func healthcheckURL(address string, healthcheckPath string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "http://" + address + healthcheckPath
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+
+	return "http://" + net.JoinHostPort(host, port) + healthcheckPath
+}
+
+// Get the value of the environment variable named by key, or fallback if it is not set.
+func getenvDefault(key string, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,98 @@
+// Command lint checks a manual source against the folder structure specification
+// and reports every problem it finds.
+//
+// The exit code is 0 when there are no errors, 1 when there are errors and 2 when the source could not be checked.
+// Warnings do not change the exit code.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+)
+
+const (
+	exitErrors int = 1
+	exitFailed int = 2
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [source]\n\nsource is a local directory or git repository (default \".\").\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	branch := flag.String("branch", "", "branch of the git repository to check")
+	ref := flag.String("ref", "", "tag or commit hash of the git repository to check")
+	fallbackLang := flag.String("fallback-lang", os.Getenv("NFH_FALLBACK_LANG"), "comma separated languages every manual should be available in at least one of (e.g. nl-NL,en-US)")
+	checkRemote := flag.Bool("remote", false, "check if remote images can be downloaded")
+	markdownExtensions := flag.String("markdown-extensions", os.Getenv("NFH_MARKDOWN_EXTENSIONS"), "comma separated markdown extensions for sources without a markdown.json file")
+	jsonOutput := flag.Bool("json", false, "write problems as JSON")
+	flag.Parse()
+
+	source := "."
+	if flag.NArg() > 0 {
+		source = flag.Arg(0)
+	}
+
+	options := parser.LintOptions{
+		CheckRemote: *checkRemote,
+	}
+
+	extensions, err := parser.ParseExtensions(*markdownExtensions)
+	if err != nil {
+		fail(err)
+	}
+	options.Extensions = extensions
+
+	if *fallbackLang != "" {
+		fallbacks, err := parser.ParseFallbackLanguages(*fallbackLang)
+		if err != nil {
+			fail(fmt.Errorf("fallback language: %w", err))
+		}
+		options.FallbackLanguages = fallbacks
+	}
+
+	credentials, err := parser.CredentialsFromEnv()
+	if err != nil {
+		fail(err)
+	}
+
+	sourceFS, err := parser.NewSource(source, *branch, *ref, credentials)
+	if err != nil {
+		fail(err)
+	}
+
+	problems := parser.Lint(sourceFS, options)
+	parser.Close(sourceFS)
+
+	if *jsonOutput {
+		if problems == nil {
+			problems = []parser.Problem{}
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(problems)
+		if err != nil {
+			fail(err)
+		}
+	} else {
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+	}
+
+	if parser.HasErrors(problems) {
+		os.Exit(exitErrors)
+	}
+}
+
+// Print err and exit, because the source could not be checked.
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(exitFailed)
+}
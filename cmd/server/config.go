@@ -2,95 +2,673 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	needforheatmanualserver "github.com/energietransitie/needforheat-manual-server"
 	"github.com/energietransitie/needforheat-manual-server/parser"
 	"golang.org/x/text/language"
 )
 
 const (
-	SourceEnvDefault string = "./source"
+	ListenAddressEnvDefault     string        = ":8080"
+	OutputDirEnvDefault         string        = "./parsed"
+	LogLevelEnvDefault          string        = logLevelDebug
+	HealthcheckPathEnvDefault   string        = "/healthcheck"
+	RequestTimeoutEnvDefault    time.Duration = 30 * time.Second
+	ReadHeaderTimeoutEnvDefault time.Duration = 10 * time.Second
+	IdleTimeoutEnvDefault       time.Duration = 2 * time.Minute
+	ShutdownTimeoutEnvDefault   time.Duration = 30 * time.Second
+	SourceEnvDefault            string        = "./source"
+	PollIntervalEnvDefault      time.Duration = 5 * time.Minute
+	ImageModeEnvDefault         string        = "files"
+	JPEGQualityEnvDefault       int           = 85
+	CompressionEnvDefault       int           = 5
+)
+
+const (
+	logLevelDebug = "debug"
+	logLevelInfo  = "info"
+	logLevelNone  = "none"
 )
 
 var (
-	ErrFallbackLangEnvNotSet = errors.New("environment variable NFH_FALLBACK_LANG was not set")
+	ErrFallbackLangEnvNotSet = errors.New("NFH_FALLBACK_LANG was not set in the config file, the environment or with -fallback-lang")
+	ErrSourceEnvEmpty        = errors.New("NFH_MANUAL_SOURCE does not contain a source")
+	ErrLogLevelInvalid       = errors.New("log level must be 'debug', 'info' or 'none'")
 )
 
 // Config contains the configuration for the server.
+//
+// Every setting can be set in the config file, by an environment variable or by a command-line flag,
+// see settings for their names. Flags take precedence over environment variables,
+// which take precedence over the config file.
 type Config struct {
+	// ListenAddress is the address manuals are served on.
+	//
+	// Set by environment variable NFH_LISTEN_ADDRESS (default ':8080').
+	ListenAddress string
+
+	// OutputDir is the directory the parsed manuals are written to. Its contents are replaced.
+	//
+	// Set by environment variable NFH_OUTPUT_DIR (default './parsed').
+	OutputDir string
+
+	// LogLevel sets what is logged.
+	//
+	// Set by environment variable NFH_LOG_LEVEL.
+	//
+	// This can be 'debug' (default) to log messages and every request,
+	// 'info' to only log messages, or 'none' to not log anything.
+	LogLevel string
+
+	// HealthcheckPath is the path of the healthcheck endpoint.
+	//
+	// Set by environment variable NFH_HEALTHCHECK_PATH (default '/healthcheck').
+	//
+	// Set it to an empty value to disable the endpoint.
+	HealthcheckPath string
+
+	// Timeouts of the HTTP server.
+	//
+	// Set by environment variables:
+	//   - NFH_REQUEST_TIMEOUT: maximum time to handle a request (default 30s).
+	//   - NFH_READ_HEADER_TIMEOUT: maximum time to read the headers of a request (default 10s).
+	//   - NFH_IDLE_TIMEOUT: maximum time to keep an idle connection open (default 2m).
+	//   - NFH_SHUTDOWN_TIMEOUT: maximum time to finish requests when shutting down (default 30s).
+	RequestTimeout    time.Duration
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+
 	// Source is where the manuals are pulled from.
 	//
 	// Set by environment variable NFH_MANUAL_SOURCE.
 	//
-	// This can be a local directory or a git repository.
-	// A local directory has to be a regular path (e.g. 'source' or './source').
-	// A git repository has to start with https:// and end with .git (e.g. 'https://github.com/energietransitie/twomes-presence-detector-firmware.git').
+	// This can be a comma separated list of sources, which are combined.
+	// A file that is in more than one source is read from the first source that has it.
+	//
+	// A source can be a local directory or a git repository.
+	// A local directory has to be a regular path to an existing directory (e.g. 'source' or './source').
+	// A git repository can be any git URL, using https://, http://, ssh://, git:// or file://
+	// (e.g. 'https://github.com/energietransitie/twomes-presence-detector-firmware.git'),
+	// or an SCP-like URL (e.g. 'git@github.com:energietransitie/twomes-presence-detector-firmware.git').
 	//
 	// The default branch is used, unless you set NFH_MANUAL_SOURCE_BRANCH to a branch name.
+	// To pin a git repository to a specific revision, set NFH_MANUAL_SOURCE_REF to a tag or commit hash instead.
+	// The branch and ref only apply to the first source.
 	Source fs.FS
 
-	// FallbackLanguage sets the fallback language for when
+	// Credentials are used to clone private git repositories,
+	// both for the manual source and for device firmware repositories.
+	//
+	// Default credentials are set by environment variables:
+	//   - NFH_GIT_USERNAME: username for HTTP or SSH authentication.
+	//   - NFH_GIT_PASSWORD: password or token for HTTP authentication.
+	//   - NFH_GIT_SSH_KEY_FILE: path to a private key for SSH authentication.
+	//   - NFH_GIT_SSH_KEY_PASSPHRASE: passphrase for the private key.
+	//   - NFH_GIT_KNOWN_HOSTS_FILE: path to a known_hosts file to check SSH host keys.
+	//
+	// Secrets can also be read from a file (e.g. a Docker secret) by adding _FILE
+	// to the name of the environment variable (e.g. NFH_GIT_PASSWORD_FILE).
+	//
+	// Credentials for specific hosts are read from a JSON file set by environment variable NFH_GIT_CREDENTIALS_FILE.
+	Credentials *parser.Credentials
+
+	// PollInterval sets how often a git repository source is checked for new commits.
+	// A local directory source is watched for changes instead.
+	//
+	// Set by environment variable NFH_MANUAL_SOURCE_POLL_INTERVAL.
+	//
+	// This must be a duration (e.g. 30s or 5m). Set it to 0 to disable reloading manuals.
+	PollInterval time.Duration
+
+	// FallbackLanguages sets the fallback languages for when
 	// a client's Accept-Language header does not contain any available language.
+	// The first fallback language that is available is chosen.
 	//
 	// Set by environment variable NFH_FALLBACK_LANG.
 	//
-	// This must be a valid language code (e.g. nl-NL or en-US).
-	FallbackLanguage language.Tag
+	// This must be a comma separated list of valid language codes (e.g. nl-BE,nl-NL,en-US,en-GB).
+	FallbackLanguages []language.Tag
+
+	// LanguageCookie sets if the language chosen with the lang parameter (e.g. ?lang=nl-NL)
+	// is persisted in a cookie, so it is used for later requests without the parameter.
+	//
+	// Set by environment variable NFH_LANGUAGE_COOKIE.
+	//
+	// This must be 'true' (default) or 'false'.
+	LanguageCookie bool
+
+	// Resilient sets if files that cannot be parsed are skipped and listed in the build report.
+	//
+	// Set by environment variable NFH_RESILIENT.
+	//
+	// This must be 'true' or 'false' (default). When it is false, parsing stops at the first error,
+	// so the server does not start if the manuals cannot be parsed.
+	Resilient bool
+
+	// ImageMode sets how images are included in manuals.
+	//
+	// Set by environment variable NFH_IMAGE_MODE.
+	//
+	// This can be 'files' (default) to serve images as separate files that are cached by clients,
+	// or 'inline' to embed images in the HTML of every manual.
+	ImageMode parser.ImageMode
+
+	// Images sets how JPEG and PNG images are processed.
+	//
+	// Set by environment variables:
+	//   - NFH_IMAGE_WIDTHS: comma separated widths of resized variants (default '400,800,1600'), or 'none' to not process images.
+	//   - NFH_IMAGE_JPEG_QUALITY: quality of encoded JPEG images, from 1 to 100 (default 85).
+	//   - NFH_IMAGE_CONVERT_TO_JPEG: set to 'true' to encode PNG images without transparency as JPEG.
+	//
+	// Processed images are stripped of their metadata, such as GPS coordinates.
+	Images parser.ImageOptions
+
+	// Remote sets how remote images in manuals are downloaded.
+	//
+	// Set by environment variables:
+	//   - NFH_REMOTE_TIMEOUT: timeout for downloading an image (default 10s).
+	//   - NFH_REMOTE_MAX_SIZE: maximum size of an image in bytes (default 10485760).
+	//   - NFH_REMOTE_ALLOWED_HOSTS: comma separated hosts images can be downloaded from (default all hosts).
+	//   - NFH_REMOTE_OFFLINE: set to 'true' to only use cached images and keep the URL of other images.
+	Remote parser.FetchOptions
+
+	// Extensions of the markdown syntax that are enabled for manual sources without a markdown.json file.
+	//
+	// Set by environment variable NFH_MARKDOWN_EXTENSIONS as a comma separated list
+	// of 'admonitions', 'steps' and 'tabs'. No extensions are enabled by default.
+	Extensions []parser.Extension
+
+	// CacheControl sets the Cache-Control header by kind of response.
+	//
+	// Set by environment variables:
+	//   - NFH_CACHE_CONTROL_REDIRECTS: for redirects (default 'public, max-age=300').
+	//   - NFH_CACHE_CONTROL_FILES: for manuals and other files (default 'public, no-cache').
+	//   - NFH_CACHE_CONTROL_HASHED_ASSETS: for content-hashed assets (default 'public, max-age=31536000, immutable').
+	//
+	// Set a variable to an empty value to not send the header.
+	CacheControl needforheatmanualserver.CacheControl
+
+	// Compression sets how generated HTML, CSS, JavaScript and JSON files are precompressed.
+	// Precompressed files are served to clients that accept their encoding.
+	//
+	// Set by environment variables:
+	//   - NFH_GZIP_LEVEL: level of .gz files, from 1 to 9 (default 9), or -1 to not write them.
+	//   - NFH_BROTLI_LEVEL: level of .br files, from 1 to 11 (default 9), or -1 to not write them.
+	Compression parser.CompressionOptions
+
+	// CompressionLevel sets the gzip level of responses that are compressed on the fly,
+	// because there is no precompressed variant the client accepts.
+	//
+	// Set by environment variable NFH_COMPRESSION_LEVEL.
+	//
+	// This must be a number from 1 to 9 (default 5), or 0 to not compress responses on the fly.
+	CompressionLevel int
+
+	// AdminToken is the bearer token needed for admin endpoints, such as the build report.
+	//
+	// Set by environment variable NFH_ADMIN_TOKEN, or read from the file set by NFH_ADMIN_TOKEN_FILE.
+	//
+	// Admin endpoints are disabled when it is not set.
+	AdminToken string
 }
 
-// Get configuration from environment variables.
-// An error is returned if an environment variable is not set
+// Get configuration from the values of settings.
+// An error is returned if a setting is not set
 // and there is no default setting for it or if a setting was invalid.
-func getConfig() (*Config, error) {
-	source, err := parseSourceEnv()
+func getConfig(values settingValues) (*Config, error) {
+	logLevel, err := parseLogLevelEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	requestTimeout, err := parseDurationEnv(values, "NFH_REQUEST_TIMEOUT", RequestTimeoutEnvDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	readHeaderTimeout, err := parseDurationEnv(values, "NFH_READ_HEADER_TIMEOUT", ReadHeaderTimeoutEnvDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	idleTimeout, err := parseDurationEnv(values, "NFH_IDLE_TIMEOUT", IdleTimeoutEnvDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownTimeout, err := parseDurationEnv(values, "NFH_SHUTDOWN_TIMEOUT", ShutdownTimeoutEnvDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := parseCredentialsEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := parseSourceEnv(values, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	pollInterval, err := parsePollIntervalEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbackLangs, err := parseFallbackLangEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	languageCookie, err := parseLanguageCookieEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	resilient, err := parseResilientEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	imageMode, err := parseImageModeEnv(values)
 	if err != nil {
 		return nil, err
 	}
 
-	fallbackLang, err := parseFallbackLangEnv()
+	images, err := parseImagesEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := parseRemoteEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions, err := parseExtensionsEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheControl := parseCacheControlEnv(values)
+
+	compression, err := parseCompressionEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	compressionLevel, err := parseCompressionLevelEnv(values)
+	if err != nil {
+		return nil, err
+	}
+
+	adminToken, err := parseAdminTokenEnv(values)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Config{
-		Source:           source,
-		FallbackLanguage: fallbackLang,
+		ListenAddress:     values.lookupDefault("NFH_LISTEN_ADDRESS", ListenAddressEnvDefault),
+		OutputDir:         values.lookupDefault("NFH_OUTPUT_DIR", OutputDirEnvDefault),
+		LogLevel:          logLevel,
+		HealthcheckPath:   values.lookupDefault("NFH_HEALTHCHECK_PATH", HealthcheckPathEnvDefault),
+		RequestTimeout:    requestTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+		ShutdownTimeout:   shutdownTimeout,
+		Source:            source,
+		Credentials:       credentials,
+		PollInterval:      pollInterval,
+		FallbackLanguages: fallbackLangs,
+		LanguageCookie:    languageCookie,
+		Resilient:         resilient,
+		ImageMode:         imageMode,
+		Images:            images,
+		Remote:            remote,
+		Extensions:        extensions,
+		CacheControl:      cacheControl,
+		Compression:       compression,
+		CompressionLevel:  compressionLevel,
+		AdminToken:        adminToken,
 	}, nil
 }
 
-func parseSourceEnv() (fs.FS, error) {
-	sourceEnv, ok := os.LookupEnv("NFH_MANUAL_SOURCE")
+func parseSourceEnv(values settingValues, credentials *parser.Credentials) (fs.FS, error) {
+	sourceEnv, ok := values.lookup("NFH_MANUAL_SOURCE")
 	if !ok {
 		sourceEnv = SourceEnvDefault
 	}
 
-	sourceBranchEnv := os.Getenv("NFH_MANUAL_SOURCE_BRANCH")
+	sourceBranchEnv := values.lookupDefault("NFH_MANUAL_SOURCE_BRANCH", "")
+	sourceRefEnv := values.lookupDefault("NFH_MANUAL_SOURCE_REF", "")
 
-	if strings.Contains(sourceEnv, "https://") {
-		log.Println("using git repository", sourceEnv, "as manual source")
-		if sourceBranchEnv != "" {
-			log.Println("using branch", sourceBranchEnv)
+	var sources []fs.FS
+
+	for i, source := range strings.Split(sourceEnv, ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+
+		// The branch and ref only apply to the first source.
+		branch, ref := sourceBranchEnv, sourceRefEnv
+		if i > 0 {
+			branch, ref = "", ""
 		}
-		return parser.NewLabRepoSource(sourceEnv, sourceBranchEnv, nil)
+
+		sourceURL, err := parser.ParseSourceURL(source)
+		if err != nil {
+			return nil, fmt.Errorf("NFH_MANUAL_SOURCE: %w", err)
+		}
+
+		if sourceURL.IsGit() {
+			log.Println("using git repository", source, "as manual source")
+			if branch != "" {
+				log.Println("using branch", branch)
+			}
+			if ref != "" {
+				log.Println("using ref", ref)
+			}
+		} else {
+			if branch != "" || ref != "" {
+				log.Println("ignoring NFH_MANUAL_SOURCE_BRANCH and NFH_MANUAL_SOURCE_REF, because the manual source is a local directory")
+			}
+			log.Println("using local directory", source, "as manual source")
+		}
+
+		sourceFS, err := parser.NewSource(source, branch, ref, credentials)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, sourceFS)
 	}
-	log.Println("using local directory", sourceEnv, "as manual source")
-	return parser.NewLabDirSource(sourceEnv)
+
+	if len(sources) == 0 {
+		return nil, ErrSourceEnvEmpty
+	}
+
+	return parser.NewMultiSource(sources...), nil
+}
+
+func parseLogLevelEnv(values settingValues) (string, error) {
+	logLevel := values.lookupDefault("NFH_LOG_LEVEL", LogLevelEnvDefault)
+
+	switch logLevel {
+	case logLevelDebug, logLevelInfo, logLevelNone:
+		return logLevel, nil
+	}
+
+	return "", fmt.Errorf("NFH_LOG_LEVEL: %w, got %q", ErrLogLevelInvalid, logLevel)
+}
+
+func parseDurationEnv(values settingValues, env string, def time.Duration) (time.Duration, error) {
+	durationEnv, ok := values.lookup(env)
+	if !ok {
+		return def, nil
+	}
+
+	duration, err := time.ParseDuration(durationEnv)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", env, err)
+	}
+
+	return duration, nil
+}
+
+func parseCredentialsEnv(values settingValues) (*parser.Credentials, error) {
+	credentials, err := parser.CredentialsFromLookup(values.lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(credentials.Hosts) > 0 {
+		log.Println("using credentials for", len(credentials.Hosts), "hosts from", values.lookupDefault("NFH_GIT_CREDENTIALS_FILE", ""))
+	}
+
+	return credentials, nil
+}
+
+func parsePollIntervalEnv(values settingValues) (time.Duration, error) {
+	pollIntervalEnv, ok := values.lookup("NFH_MANUAL_SOURCE_POLL_INTERVAL")
+	if !ok {
+		return PollIntervalEnvDefault, nil
+	}
+
+	pollInterval, err := time.ParseDuration(pollIntervalEnv)
+	if err != nil {
+		return 0, err
+	}
+
+	return pollInterval, nil
 }
 
-func parseFallbackLangEnv() (language.Tag, error) {
-	fallbackLangEnv, ok := os.LookupEnv("NFH_FALLBACK_LANG")
+func parseFallbackLangEnv(values settingValues) ([]language.Tag, error) {
+	fallbackLangEnv, ok := values.lookup("NFH_FALLBACK_LANG")
+	if !ok {
+		return nil, ErrFallbackLangEnvNotSet
+	}
+
+	langs, err := parser.ParseFallbackLanguages(fallbackLangEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("using", fallbackLangEnv, "as fallback languages")
+	return langs, nil
+}
+
+func parseLanguageCookieEnv(values settingValues) (bool, error) {
+	languageCookieEnv, ok := values.lookup("NFH_LANGUAGE_COOKIE")
+	if !ok {
+		return true, nil
+	}
+
+	languageCookie, err := strconv.ParseBool(languageCookieEnv)
+	if err != nil {
+		return false, fmt.Errorf("NFH_LANGUAGE_COOKIE: %w", err)
+	}
+
+	return languageCookie, nil
+}
+
+func parseResilientEnv(values settingValues) (bool, error) {
+	resilientEnv, ok := values.lookup("NFH_RESILIENT")
+	if !ok {
+		return false, nil
+	}
+
+	resilient, err := strconv.ParseBool(resilientEnv)
+	if err != nil {
+		return false, fmt.Errorf("NFH_RESILIENT: %w", err)
+	}
+
+	return resilient, nil
+}
+
+func parseImageModeEnv(values settingValues) (parser.ImageMode, error) {
+	imageModeEnv, ok := values.lookup("NFH_IMAGE_MODE")
+	if !ok {
+		imageModeEnv = ImageModeEnvDefault
+	}
+
+	imageMode, err := parser.ParseImageMode(imageModeEnv)
+	if err != nil {
+		return "", fmt.Errorf("NFH_IMAGE_MODE: %w", err)
+	}
+
+	return imageMode, nil
+}
+
+func parseImagesEnv(values settingValues) (parser.ImageOptions, error) {
+	options := parser.ImageOptions{
+		Widths:      parser.DefaultImageWidths,
+		JPEGQuality: JPEGQualityEnvDefault,
+	}
+
+	widthsEnv, ok := values.lookup("NFH_IMAGE_WIDTHS")
+	if ok {
+		widths, err := parser.ParseImageWidths(widthsEnv)
+		if err != nil {
+			return options, fmt.Errorf("NFH_IMAGE_WIDTHS: %w", err)
+		}
+		options.Widths = widths
+	}
+
+	qualityEnv, ok := values.lookup("NFH_IMAGE_JPEG_QUALITY")
+	if ok {
+		quality, err := strconv.Atoi(qualityEnv)
+		if err != nil || quality < 1 || quality > 100 {
+			return options, fmt.Errorf("NFH_IMAGE_JPEG_QUALITY: must be a number from 1 to 100, got %q", qualityEnv)
+		}
+		options.JPEGQuality = quality
+	}
+
+	convertEnv, ok := values.lookup("NFH_IMAGE_CONVERT_TO_JPEG")
+	if ok {
+		convert, err := strconv.ParseBool(convertEnv)
+		if err != nil {
+			return options, fmt.Errorf("NFH_IMAGE_CONVERT_TO_JPEG: %w", err)
+		}
+		options.ConvertToJPEG = convert
+	}
+
+	return options, nil
+}
+
+func parseRemoteEnv(values settingValues) (parser.FetchOptions, error) {
+	var options parser.FetchOptions
+
+	timeoutEnv, ok := values.lookup("NFH_REMOTE_TIMEOUT")
+	if ok {
+		timeout, err := time.ParseDuration(timeoutEnv)
+		if err != nil {
+			return options, fmt.Errorf("NFH_REMOTE_TIMEOUT: %w", err)
+		}
+		options.Timeout = timeout
+	}
+
+	maxSizeEnv, ok := values.lookup("NFH_REMOTE_MAX_SIZE")
+	if ok {
+		maxSize, err := strconv.ParseInt(maxSizeEnv, 10, 64)
+		if err != nil || maxSize <= 0 {
+			return options, fmt.Errorf("NFH_REMOTE_MAX_SIZE: must be a number of bytes, got %q", maxSizeEnv)
+		}
+		options.MaxSize = maxSize
+	}
+
+	allowedHostsEnv, ok := values.lookup("NFH_REMOTE_ALLOWED_HOSTS")
+	if ok && allowedHostsEnv != "" {
+		for _, host := range strings.Split(allowedHostsEnv, ",") {
+			options.AllowedHosts = append(options.AllowedHosts, strings.TrimSpace(host))
+		}
+	}
+
+	offlineEnv, ok := values.lookup("NFH_REMOTE_OFFLINE")
+	if ok {
+		offline, err := strconv.ParseBool(offlineEnv)
+		if err != nil {
+			return options, fmt.Errorf("NFH_REMOTE_OFFLINE: %w", err)
+		}
+		options.Offline = offline
+	}
+
+	return options, nil
+}
+
+func parseExtensionsEnv(values settingValues) ([]parser.Extension, error) {
+	extensions, err := parser.ParseExtensions(values.lookupDefault("NFH_MARKDOWN_EXTENSIONS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("NFH_MARKDOWN_EXTENSIONS: %w", err)
+	}
+
+	return extensions, nil
+}
+
+func parseCacheControlEnv(values settingValues) needforheatmanualserver.CacheControl {
+	cacheControl := needforheatmanualserver.DefaultCacheControl
+
+	if value, ok := values.lookup("NFH_CACHE_CONTROL_REDIRECTS"); ok {
+		cacheControl.Redirects = value
+	}
+	if value, ok := values.lookup("NFH_CACHE_CONTROL_FILES"); ok {
+		cacheControl.Files = value
+	}
+	if value, ok := values.lookup("NFH_CACHE_CONTROL_HASHED_ASSETS"); ok {
+		cacheControl.HashedAssets = value
+	}
+
+	return cacheControl
+}
+
+func parseCompressionEnv(values settingValues) (parser.CompressionOptions, error) {
+	var options parser.CompressionOptions
+
+	gzipLevelEnv, ok := values.lookup("NFH_GZIP_LEVEL")
+	if ok {
+		level, err := strconv.Atoi(gzipLevelEnv)
+		if err != nil || level == 0 || level < -1 {
+			return options, fmt.Errorf("NFH_GZIP_LEVEL: must be a number from 1 to 9 or -1, got %q", gzipLevelEnv)
+		}
+		options.GzipLevel = level
+	}
+
+	brotliLevelEnv, ok := values.lookup("NFH_BROTLI_LEVEL")
+	if ok {
+		level, err := strconv.Atoi(brotliLevelEnv)
+		if err != nil || level == 0 || level < -1 {
+			return options, fmt.Errorf("NFH_BROTLI_LEVEL: must be a number from 1 to 11 or -1, got %q", brotliLevelEnv)
+		}
+		options.BrotliLevel = level
+	}
+
+	err := options.Validate()
+	if err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+func parseCompressionLevelEnv(values settingValues) (int, error) {
+	compressionLevelEnv, ok := values.lookup("NFH_COMPRESSION_LEVEL")
+	if !ok {
+		return CompressionEnvDefault, nil
+	}
+
+	level, err := strconv.Atoi(compressionLevelEnv)
+	if err != nil || level < 0 || level > 9 {
+		return 0, fmt.Errorf("NFH_COMPRESSION_LEVEL: must be a number from 0 to 9, got %q", compressionLevelEnv)
+	}
+
+	return level, nil
+}
+
+func parseAdminTokenEnv(values settingValues) (string, error) {
+	adminTokenEnv, ok := values.lookup("NFH_ADMIN_TOKEN")
+	if ok {
+		return adminTokenEnv, nil
+	}
+
+	adminTokenFileEnv, ok := values.lookup("NFH_ADMIN_TOKEN_FILE")
 	if !ok {
-		return language.Tag{}, ErrFallbackLangEnvNotSet
+		log.Println("admin endpoints are disabled, because NFH_ADMIN_TOKEN was not set")
+		return "", nil
 	}
 
-	lang, err := language.Parse(fallbackLangEnv)
+	data, err := os.ReadFile(adminTokenFileEnv)
 	if err != nil {
-		return language.Tag{}, err
+		return "", fmt.Errorf("NFH_ADMIN_TOKEN_FILE: %w", err)
 	}
 
-	log.Println("using", fallbackLangEnv, "as fallback language")
-	return lang, nil
+	return strings.TrimSpace(string(data)), nil
 }
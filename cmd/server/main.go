@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -20,20 +22,59 @@ import (
 )
 
 func main() {
+	configFile := flag.String("config", os.Getenv("NFH_CONFIG_FILE"), "YAML config file to read settings from (also NFH_CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	flagValues := defineSettingFlags(flag.CommandLine)
+	flag.Parse()
+
+	values, err := loadSettings(*configFile, flagValues())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *printConfig {
+		err = printSettings(os.Stdout, values)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// The log level is set first, so it applies to messages about the configuration as well.
+	logLevel, err := parseLogLevelEnv(values)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if logLevel == logLevelNone {
+		log.SetOutput(io.Discard)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	conf, err := getConfig()
+	conf, err := getConfig(values)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	//Parser parses every manual so it can be served
-	parsedFS := dirfs.New("./parsed")
+	manualParser := parser.New(dirfs.New(conf.OutputDir), parser.Options{
+		Credentials: conf.Credentials,
+		ImageMode:   conf.ImageMode,
+		Images:      conf.Images,
+		Remote:      conf.Remote,
+		Extensions:  conf.Extensions,
+		Compression: conf.Compression,
+		Resilient:   conf.Resilient,
+	})
 
-	localDirParser := parser.New(parsedFS)
+	// Without resilience, which is the default, the server does not start with manuals that cannot be parsed.
+	err = manualParser.Parse(conf.Source)
+	if err != nil {
+		log.Fatal("error parsing manuals: ", err)
+	}
 
-	err = localDirParser.Parse(conf.Source)
+	parsedFS, err := manualParser.Current()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -41,31 +82,92 @@ func main() {
 	log.Println("generated folder structure to be served")
 
 	server := needforheatmanualserver.NewServer(parsedFS, needforheatmanualserver.ServerOptions{
-		FallbackLanguage: conf.FallbackLanguage,
+		FallbackLanguages: conf.FallbackLanguages,
+		LanguageCookie:    conf.LanguageCookie,
+		CacheControl:      &conf.CacheControl,
+		AdminToken:        conf.AdminToken,
 	})
 
+	go reloadOnChange(ctx, conf, server, manualParser)
+
 	r := chi.NewRouter()
 
 	//CleanPathRedirect is the router, it will make sure everything redirects to the right page
-	r.Use(middleware.Timeout(time.Second * 30))
-	r.Use(middleware.Heartbeat("/healthcheck"))
+	if conf.RequestTimeout > 0 {
+		r.Use(middleware.Timeout(conf.RequestTimeout))
+	}
+	if conf.HealthcheckPath != "" {
+		r.Use(middleware.Heartbeat(conf.HealthcheckPath))
+	}
 	r.Use(custommiddleware.CleanPathRedirect)
-	r.Use(middleware.Logger)
+	if conf.LogLevel == logLevelDebug {
+		r.Use(middleware.Logger)
+	}
+	if conf.CompressionLevel > 0 {
+		r.Use(custommiddleware.Compress(conf.CompressionLevel))
+	}
 
 	r.Mount("/", server)
 
 	httpServer := &http.Server{
-		Addr:        ":8080",
-		Handler:     r,
-		BaseContext: returnContextFn(ctx),
+		Addr:              conf.ListenAddress,
+		Handler:           r,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		BaseContext:       returnContextFn(ctx),
 	}
 
-	err = listenAndServe(ctx, httpServer)
+	err = listenAndServe(ctx, httpServer, conf.ShutdownTimeout)
 	if err != nil {
 		log.Println(err)
 	}
 }
 
+// Regenerate the served folder structure every time the manual source changes,
+// until ctx is cancelled.
+//
+// The server keeps serving the previous folder structure until the new one is completely generated.
+func reloadOnChange(ctx context.Context, conf *Config, server *needforheatmanualserver.Server, manualParser *parser.Parser) {
+	if conf.PollInterval <= 0 {
+		log.Println("reloading manuals is disabled")
+		return
+	}
+
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		err := parser.Watch(ctx, conf.Source, conf.PollInterval, changed)
+		if err != nil {
+			log.Println("not watching manual source for changes:", err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			log.Println("manual source changed, regenerating folder structure")
+
+			err := manualParser.Parse(conf.Source)
+			if err != nil {
+				log.Println("error regenerating folder structure, serving previous version:", err)
+				continue
+			}
+
+			parsedFS, err := manualParser.Current()
+			if err != nil {
+				log.Println("error opening regenerated folder structure:", err)
+				continue
+			}
+
+			server.SetFS(parsedFS)
+
+			log.Println("serving regenerated folder structure")
+		}
+	}
+}
+
 // Return a function for BaseContext that always returns context ctx.
 func returnContextFn(ctx context.Context) func(net.Listener) context.Context {
 	return func(_ net.Listener) context.Context {
@@ -74,7 +176,8 @@ func returnContextFn(ctx context.Context) func(net.Listener) context.Context {
 }
 
 // Start HTTP server and gracefully shutdown if the context is cancelled.
-func listenAndServe(ctx context.Context, server *http.Server) error {
+// Requests that did not finish within shutdownTimeout are cancelled, unless it is 0.
+func listenAndServe(ctx context.Context, server *http.Server, shutdownTimeout time.Duration) error {
 	g, gCtx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
@@ -85,7 +188,15 @@ func listenAndServe(ctx context.Context, server *http.Server) error {
 
 	g.Go(func() error {
 		<-gCtx.Done()
-		return server.Shutdown(context.Background())
+
+		shutdownCtx := context.Background()
+		if shutdownTimeout > 0 {
+			var cancel context.CancelFunc
+			shutdownCtx, cancel = context.WithTimeout(shutdownCtx, shutdownTimeout)
+			defer cancel()
+		}
+
+		return server.Shutdown(shutdownCtx)
 	})
 
 	return g.Wait()
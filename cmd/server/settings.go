@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	needforheatmanualserver "github.com/energietransitie/needforheat-manual-server"
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// Where the value of a setting comes from, from lowest to highest precedence.
+const (
+	originDefault = "default"
+	originFile    = "config file"
+	originEnv     = "environment"
+	originFlag    = "flag"
+)
+
+// Shown instead of the value of a secret setting when the configuration is printed.
+const redacted = "[redacted]"
+
+// A setting is a configuration setting that can be set in the config file,
+// by an environment variable and by a command-line flag.
+type setting struct {
+	// Environment variable, which also identifies the setting.
+	env string
+	// Key in the config file. Keys in a group are separated by a dot (e.g. cache_control.files).
+	key string
+	// Command-line flag, or empty for secrets, which should not be visible in the process list.
+	flag string
+	// Default value, as it is shown in the usage and printed configuration.
+	// Empty if the setting has no default or its default depends on other settings.
+	def   string
+	usage string
+	// The value is redacted when the configuration is printed.
+	secret bool
+}
+
+// Settings of the server, in the order they are printed.
+// Settings with the same group in their key have to be next to each other.
+var settings = []setting{
+	{env: "NFH_LISTEN_ADDRESS", key: "listen_address", flag: "listen-address", def: ListenAddressEnvDefault, usage: "address to serve manuals on"},
+	{env: "NFH_OUTPUT_DIR", key: "output_dir", flag: "output-dir", def: OutputDirEnvDefault, usage: "directory to write the parsed manuals to; its contents are replaced"},
+	{env: "NFH_LOG_LEVEL", key: "log_level", flag: "log-level", def: LogLevelEnvDefault, usage: "'debug' to log messages and requests, 'info' to only log messages, or 'none'"},
+	{env: "NFH_HEALTHCHECK_PATH", key: "healthcheck_path", flag: "healthcheck-path", def: HealthcheckPathEnvDefault, usage: "path of the healthcheck endpoint, or empty to disable it"},
+
+	{env: "NFH_REQUEST_TIMEOUT", key: "timeouts.request", flag: "request-timeout", def: RequestTimeoutEnvDefault.String(), usage: "maximum time to handle a request"},
+	{env: "NFH_READ_HEADER_TIMEOUT", key: "timeouts.read_header", flag: "read-header-timeout", def: ReadHeaderTimeoutEnvDefault.String(), usage: "maximum time to read the headers of a request"},
+	{env: "NFH_IDLE_TIMEOUT", key: "timeouts.idle", flag: "idle-timeout", def: IdleTimeoutEnvDefault.String(), usage: "maximum time to keep an idle connection open"},
+	{env: "NFH_SHUTDOWN_TIMEOUT", key: "timeouts.shutdown", flag: "shutdown-timeout", def: ShutdownTimeoutEnvDefault.String(), usage: "maximum time to finish requests when shutting down"},
+
+	{env: "NFH_MANUAL_SOURCE", key: "source", flag: "source", def: SourceEnvDefault, usage: "comma separated local directories or git repositories to read manuals from; the first source that has a file wins"},
+	{env: "NFH_MANUAL_SOURCE_BRANCH", key: "source_branch", flag: "source-branch", usage: "branch of the first source, if it is a git repository"},
+	{env: "NFH_MANUAL_SOURCE_REF", key: "source_ref", flag: "source-ref", usage: "tag or commit hash of the first source, if it is a git repository"},
+	{env: "NFH_MANUAL_SOURCE_POLL_INTERVAL", key: "poll_interval", flag: "poll-interval", def: PollIntervalEnvDefault.String(), usage: "how often git repositories are checked for new commits, or 0 to disable reloading manuals"},
+
+	{env: "NFH_GIT_USERNAME", key: "git.username", flag: "git-username", usage: "username for HTTP or SSH authentication"},
+	{env: "NFH_GIT_PASSWORD", key: "git.password", usage: "password or token for HTTP authentication", secret: true},
+	{env: "NFH_GIT_PASSWORD_FILE", key: "git.password_file", flag: "git-password-file", usage: "file to read the password or token from"},
+	{env: "NFH_GIT_SSH_KEY_FILE", key: "git.ssh_key_file", flag: "git-ssh-key-file", usage: "private key for SSH authentication"},
+	{env: "NFH_GIT_SSH_KEY_PASSPHRASE", key: "git.ssh_key_passphrase", usage: "passphrase for the private key", secret: true},
+	{env: "NFH_GIT_SSH_KEY_PASSPHRASE_FILE", key: "git.ssh_key_passphrase_file", flag: "git-ssh-key-passphrase-file", usage: "file to read the passphrase for the private key from"},
+	{env: "NFH_GIT_KNOWN_HOSTS_FILE", key: "git.known_hosts_file", flag: "git-known-hosts-file", usage: "known_hosts file to check SSH host keys"},
+	{env: "NFH_GIT_CREDENTIALS_FILE", key: "git.credentials_file", flag: "git-credentials-file", usage: "JSON file with credentials for specific hosts"},
+
+	{env: "NFH_FALLBACK_LANG", key: "fallback_languages", flag: "fallback-lang", usage: "comma separated languages to use, in order, when none of the client's languages is available (e.g. nl-NL,en-US)"},
+	{env: "NFH_LANGUAGE_COOKIE", key: "language_cookie", flag: "language-cookie", def: "true", usage: "remember the language chosen with the lang parameter in a cookie"},
+	{env: "NFH_RESILIENT", key: "resilient", flag: "resilient", def: "false", usage: "skip files that cannot be parsed and list them in the build report, instead of failing"},
+	{env: "NFH_MARKDOWN_EXTENSIONS", key: "markdown_extensions", flag: "markdown-extensions", usage: "comma separated markdown extensions for sources without a markdown.json file: 'admonitions', 'steps' and 'tabs'"},
+
+	{env: "NFH_IMAGE_MODE", key: "images.mode", flag: "image-mode", def: ImageModeEnvDefault, usage: "how to include images: 'files' for separate files, or 'inline' for a single HTML file per manual"},
+	{env: "NFH_IMAGE_WIDTHS", key: "images.widths", flag: "image-widths", def: "400,800,1600", usage: "comma separated widths of resized image variants, or 'none' to not process images"},
+	{env: "NFH_IMAGE_JPEG_QUALITY", key: "images.jpeg_quality", flag: "jpeg-quality", def: strconv.Itoa(JPEGQualityEnvDefault), usage: "quality of encoded JPEG images, from 1 to 100"},
+	{env: "NFH_IMAGE_CONVERT_TO_JPEG", key: "images.convert_to_jpeg", flag: "convert-to-jpeg", def: "false", usage: "encode PNG images without transparency as JPEG"},
+
+	{env: "NFH_REMOTE_TIMEOUT", key: "remote.timeout", flag: "remote-timeout", def: "10s", usage: "timeout for downloading a remote image"},
+	{env: "NFH_REMOTE_MAX_SIZE", key: "remote.max_size", flag: "remote-max-size", def: "10485760", usage: "maximum size of a remote image in bytes"},
+	{env: "NFH_REMOTE_ALLOWED_HOSTS", key: "remote.allowed_hosts", flag: "remote-allowed-hosts", usage: "comma separated hosts remote images can be downloaded from (default all hosts)"},
+	{env: "NFH_REMOTE_OFFLINE", key: "remote.offline", flag: "offline", def: "false", usage: "do not download remote images; cached images are used and other images keep their URL"},
+
+	{env: "NFH_CACHE_CONTROL_REDIRECTS", key: "cache_control.redirects", flag: "cache-control-redirects", def: needforheatmanualserver.DefaultCacheControl.Redirects, usage: "Cache-Control header of redirects"},
+	{env: "NFH_CACHE_CONTROL_FILES", key: "cache_control.files", flag: "cache-control-files", def: needforheatmanualserver.DefaultCacheControl.Files, usage: "Cache-Control header of manuals and other files"},
+	{env: "NFH_CACHE_CONTROL_HASHED_ASSETS", key: "cache_control.hashed_assets", flag: "cache-control-hashed-assets", def: needforheatmanualserver.DefaultCacheControl.HashedAssets, usage: "Cache-Control header of content-hashed assets"},
+
+	{env: "NFH_GZIP_LEVEL", key: "compression.gzip_level", flag: "gzip-level", def: strconv.Itoa(parser.DefaultGzipLevel), usage: "level of precompressed .gz files, from 1 to 9, or -1 to not write them"},
+	{env: "NFH_BROTLI_LEVEL", key: "compression.brotli_level", flag: "brotli-level", def: strconv.Itoa(parser.DefaultBrotliLevel), usage: "level of precompressed .br files, from 1 to 11, or -1 to not write them"},
+	{env: "NFH_COMPRESSION_LEVEL", key: "compression.level", flag: "compression-level", def: strconv.Itoa(CompressionEnvDefault), usage: "gzip level of responses compressed on the fly, from 1 to 9, or 0 to disable it"},
+
+	{env: "NFH_ADMIN_TOKEN", key: "admin.token", usage: "bearer token for admin endpoints", secret: true},
+	{env: "NFH_ADMIN_TOKEN_FILE", key: "admin.token_file", flag: "admin-token-file", usage: "file to read the bearer token for admin endpoints from"},
+}
+
+// A settingValue is the value of a setting and where it comes from.
+type settingValue struct {
+	value  string
+	origin string
+}
+
+// settingValues are the values of settings that were set, by the environment variable of the setting.
+type settingValues map[string]settingValue
+
+// Return the value of the setting with environment variable env, and if it was set.
+// Defaults are not returned, so the configuration can tell if a setting was set.
+func (v settingValues) lookup(env string) (string, bool) {
+	value, ok := v[env]
+	return value.value, ok
+}
+
+// Return the value of the setting with environment variable env, or def if it was not set.
+func (v settingValues) lookupDefault(env string, def string) string {
+	value, ok := v.lookup(env)
+	if !ok {
+		return def
+	}
+
+	return value
+}
+
+// Define a string flag for every setting that has one on flags.
+// The returned function returns the values of the flags that were set, after flags are parsed.
+func defineSettingFlags(flags *flag.FlagSet) func() settingValues {
+	values := map[string]*string{}
+
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+
+		values[s.flag] = flags.String(s.flag, s.def, s.usage+" (also "+s.env+")")
+	}
+
+	return func() settingValues {
+		flagValues := settingValues{}
+
+		flags.Visit(func(f *flag.Flag) {
+			for _, s := range settings {
+				if s.flag == f.Name {
+					flagValues[s.env] = settingValue{*values[f.Name], originFlag}
+				}
+			}
+		})
+
+		return flagValues
+	}
+}
+
+// Merge the settings in the config file at configFile, the environment and flagValues.
+// Flags take precedence over environment variables, which take precedence over the config file.
+//
+// No config file is read if configFile is empty.
+func loadSettings(configFile string, flagValues settingValues) (settingValues, error) {
+	values := settingValues{}
+
+	if configFile != "" {
+		fileValues, err := readConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for env, value := range fileValues {
+			values[env] = value
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			values[s.env] = settingValue{value, originEnv}
+		}
+	}
+
+	for env, value := range flagValues {
+		values[env] = value
+	}
+
+	return values, nil
+}
+
+// Read the settings in the YAML config file at filePath.
+//
+// Settings in a group are nested in the group (e.g. cache_control with files in it).
+// A list is the same as a comma separated value, and unknown keys are an error.
+func readConfigFile(filePath string) (settingValues, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var file map[string]any
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	flattened := map[string]string{}
+	err = flattenConfig("", file, flattened)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	values := settingValues{}
+
+	for key, value := range flattened {
+		s, ok := settingByKey(key)
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown setting %q", filePath, key)
+		}
+
+		values[s.env] = settingValue{value, originFile}
+	}
+
+	return values, nil
+}
+
+// Add the values in group to flattened, by their key prefixed with prefix.
+func flattenConfig(prefix string, group map[string]any, flattened map[string]string) error {
+	for key, value := range group {
+		key = prefix + key
+
+		switch value := value.(type) {
+		case map[string]any:
+			err := flattenConfig(key+".", value, flattened)
+			if err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				if _, ok := item.(map[string]any); ok {
+					return fmt.Errorf("setting %q must be a list of values", key)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			flattened[key] = strings.Join(items, ",")
+		case nil:
+			flattened[key] = ""
+		default:
+			flattened[key] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+// Return the setting with key in the config file.
+func settingByKey(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+
+	return setting{}, false
+}
+
+// Print the effective configuration to w in the format of the config file,
+// with where every value comes from. Secrets and credentials in URLs are redacted.
+func printSettings(w io.Writer, values settingValues) error {
+	var (
+		b     strings.Builder
+		group string
+	)
+
+	b.WriteString("# Effective configuration. Settings without a value are not set.\n")
+
+	for _, s := range settings {
+		key := s.key
+
+		settingGroup, name, ok := strings.Cut(s.key, ".")
+		if !ok {
+			settingGroup = ""
+		}
+		if settingGroup != group {
+			group = settingGroup
+			if group != "" {
+				fmt.Fprintf(&b, "%s:\n", group)
+			}
+		}
+		if group != "" {
+			key = "  " + name
+		}
+
+		value, ok := values[s.env]
+		if !ok {
+			if s.def == "" {
+				// Commented out, because an empty value is not the same as a setting that is not set.
+				indent := strings.TrimSuffix(key, strings.TrimSpace(key))
+				fmt.Fprintf(&b, "%s# %s: # %s (not set)\n", indent, strings.TrimSpace(key), s.env)
+				continue
+			}
+			value = settingValue{s.def, originDefault}
+		}
+
+		if s.secret && value.value != "" {
+			value.value = redacted
+		} else {
+			value.value = redactURLs(value.value)
+		}
+
+		fmt.Fprintf(&b, "%s: %s # %s (%s)\n", key, strconv.Quote(value.value), s.env, value.origin)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Remove the userinfo, which can contain credentials, from every URL in value, which can be a comma separated list.
+func redactURLs(value string) string {
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		url := strings.TrimSpace(item)
+		items[i] = strings.Replace(item, url, parser.RedactURL(url), 1)
+	}
+
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,46 @@
+package needforheatmanualserver
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/energietransitie/needforheat-manual-server/middleware"
+	"github.com/energietransitie/needforheat-manual-server/parser"
+)
+
+// Serve the file at filePath from manifest precompressed, if it has a precompressed variant the client accepts.
+// Returns false if the file should be served as it is.
+//
+// Files with a precompressed variant get a Vary: Accept-Encoding header, also when they are served as they are.
+func servePrecompressedFile(w http.ResponseWriter, r *http.Request, fsys fs.FS, manifest parser.Manifest, filePath string) (bool, error) {
+	hasVariant := false
+
+	for _, encoding := range parser.Encodings {
+		compressed, ok := manifest[filePath+encoding.Extension]
+		if !ok {
+			continue
+		}
+		hasVariant = true
+
+		if !middleware.AcceptsEncoding(r, encoding.Name) {
+			continue
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Accept-Encoding")
+		header.Set("Content-Encoding", encoding.Name)
+		if contentType := mime.TypeByExtension(path.Ext(filePath)); contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+
+		return true, serveManifestFile(w, r, fsys, filePath+encoding.Extension, compressed)
+	}
+
+	if hasVariant {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	return false, nil
+}
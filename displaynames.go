@@ -0,0 +1,135 @@
+package needforheatmanualserver
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"golang.org/x/text/language"
+)
+
+// A DisplayName is the display name that best matches the languages of a client.
+type DisplayName struct {
+	Language    string `json:"language"`
+	DisplayName string `json:"display_name"`
+}
+
+// A DisplayNamesResponse contains the display names of all devices, energy queries and cloud feeds, by name.
+// T is the display names of an entity by language code, or the DisplayName that best matches the client.
+type DisplayNamesResponse[T any] struct {
+	Devices       map[string]T `json:"devices"`
+	EnergyQueries map[string]T `json:"energy_queries"`
+	CloudFeeds    map[string]T `json:"cloud_feeds"`
+}
+
+// Handle serving display_names.json for a requested device, energy query or cloud feed.
+//
+// When the lang parameter is set, only the display name that best matches it is served.
+// An empty lang parameter (e.g. ?lang) chooses the language with the language cookie or the Accept-Language header.
+func (s *Server) handleDisplayName(w http.ResponseWriter, r *http.Request) error {
+	urlPath := strings.Trim(r.URL.Path, "/")
+	fsys := s.FS()
+
+	file, err := fs.ReadFile(fsys, path.Join(urlPath, "display_names.json"))
+	if err != nil {
+		return NewHandlerError(err, http.StatusNotFound)
+	}
+
+	if !r.URL.Query().Has(languageParam) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(file)
+		return nil
+	}
+
+	var displayNames map[string]string
+	err = json.Unmarshal(file, &displayNames)
+	if err != nil {
+		return NewHandlerError(err, http.StatusInternalServerError)
+	}
+
+	options := displayNameLanguages(displayNames)
+	if len(options) == 0 {
+		return NewHandlerError(fs.ErrNotExist, http.StatusNotFound)
+	}
+
+	lang := s.chooseLanguage(w, fsys, urlPath, options, s.languagePreferences(r)...)
+
+	return writeJSON(w, DisplayName{
+		Language:    lang.String(),
+		DisplayName: displayNames[lang.String()],
+	})
+}
+
+// Handle serving the display names of all devices, energy queries and cloud feeds.
+//
+// When the lang parameter is set, only the display name that best matches it is served for every entity,
+// the same way as by handleDisplayName. Entities without display names are left out.
+func (s *Server) handleDisplayNames(w http.ResponseWriter, r *http.Request) error {
+	catalog, err := s.readCatalog()
+	if err != nil {
+		return err
+	}
+
+	if !r.URL.Query().Has(languageParam) {
+		all := func(displayNames map[string]string) (map[string]string, bool) {
+			return displayNames, len(displayNames) > 0
+		}
+
+		return writeJSON(w, DisplayNamesResponse[map[string]string]{
+			Devices:       entityDisplayNames(catalog.Devices, all),
+			EnergyQueries: entityDisplayNames(catalog.EnergyQueries, all),
+			CloudFeeds:    entityDisplayNames(catalog.CloudFeeds, all),
+		})
+	}
+
+	preferences := s.languagePreferences(r)
+
+	choose := func(displayNames map[string]string) (DisplayName, bool) {
+		options := displayNameLanguages(displayNames)
+		if len(options) == 0 {
+			return DisplayName{}, false
+		}
+
+		lang, _ := ChooseLanguage(options, s.options.FallbackLanguages, preferences...)
+		return DisplayName{Language: lang.String(), DisplayName: displayNames[lang.String()]}, true
+	}
+
+	return writeJSON(w, DisplayNamesResponse[DisplayName]{
+		Devices:       entityDisplayNames(catalog.Devices, choose),
+		EnergyQueries: entityDisplayNames(catalog.EnergyQueries, choose),
+		CloudFeeds:    entityDisplayNames(catalog.CloudFeeds, choose),
+	})
+}
+
+// Return the display names of entities by name, converted with convert.
+// Entities for which convert returns false are left out.
+func entityDisplayNames[T any](entities []parser.CatalogEntity, convert func(map[string]string) (T, bool)) map[string]T {
+	displayNames := map[string]T{}
+
+	for _, entity := range entities {
+		displayName, ok := convert(entity.DisplayNames)
+		if ok {
+			displayNames[entity.Name] = displayName
+		}
+	}
+
+	return displayNames
+}
+
+// Return the languages of displayNames. Language codes that are not valid or not canonical are left out,
+// so every returned language is a key of displayNames.
+func displayNameLanguages(displayNames map[string]string) []language.Tag {
+	var tags []language.Tag
+
+	for lang := range displayNames {
+		tag, err := language.Parse(lang)
+		if err == nil && tag.String() == lang {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,272 @@
+package needforheatmanualserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/defaults"
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"golang.org/x/text/language"
+)
+
+const (
+	notFoundTemplateFileName = "404.html"
+	errorTemplateFileName    = "error.html"
+	contactFileName          = "contact.json"
+)
+
+// Contact contains contact details that are shown on an error page.
+type Contact struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// ErrorTemplate contains data for filling a 404.html or error.html template.
+type ErrorTemplate struct {
+	Language     string
+	Code         int
+	Status       string
+	Title        string
+	Message      string
+	ContactTitle string
+	Contact      *Contact
+	Path         string
+}
+
+// errorPageText contains the texts for an error page in a language.
+type errorPageText struct {
+	NotFoundTitle   string
+	NotFoundMessage string
+	ErrorTitle      string
+	ErrorMessage    string
+	ContactTitle    string
+}
+
+// Texts for error pages, for each language that is supported by default.
+var errorPageTexts = map[language.Tag]errorPageText{
+	language.MustParse("en-US"): {
+		NotFoundTitle:   "Manual not found",
+		NotFoundMessage: "The manual you are looking for does not exist (anymore).",
+		ErrorTitle:      "Something went wrong",
+		ErrorMessage:    "The manual could not be shown. Please try again later.",
+		ContactTitle:    "Need help? Please contact us.",
+	},
+	language.MustParse("nl-NL"): {
+		NotFoundTitle:   "Handleiding niet gevonden",
+		NotFoundMessage: "De handleiding die je zoekt bestaat niet (meer).",
+		ErrorTitle:      "Er ging iets mis",
+		ErrorMessage:    "De handleiding kon niet worden getoond. Probeer het later opnieuw.",
+		ContactTitle:    "Hulp nodig? Neem contact met ons op.",
+	},
+}
+
+// Send an error page to the HTTP client.
+//
+// The page is rendered from 404.html or error.html in the served filesystem,
+// or from the default error template if those do not exist.
+// Clients that prefer JSON get a JSON object instead.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, code int) {
+	fsys := s.FS()
+
+	contacts := readContacts(fsys, r.URL.Path)
+
+	var options []language.Tag
+	for lang := range contacts {
+		options = append(options, lang)
+	}
+	for lang := range errorPageTexts {
+		if _, ok := contacts[lang]; !ok {
+			options = append(options, lang)
+		}
+	}
+
+	lang := s.chooseLanguage(w, fsys, r.URL.Path, options, s.languagePreferences(r)...)
+
+	data := newErrorTemplate(lang.String(), code, r.URL.Path, contacts)
+
+	if prefersJSON(r) {
+		writeJSONError(w, data)
+		return
+	}
+
+	t, err := findErrorTemplate(fsys, code)
+	if err != nil {
+		log.Println("error parsing error template:", err)
+		HTTPError(w, code)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		log.Println("error executing error template:", err)
+		HTTPError(w, code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
+
+// Create the data for an error template in lang.
+func newErrorTemplate(lang string, code int, urlPath string, contacts map[language.Tag]Contact) ErrorTemplate {
+	tag := language.Make(lang)
+
+	text := errorPageTexts[matchTag(tag, errorPageTexts)]
+
+	data := ErrorTemplate{
+		Language:     lang,
+		Code:         code,
+		Status:       http.StatusText(code),
+		Title:        text.ErrorTitle,
+		Message:      text.ErrorMessage,
+		ContactTitle: text.ContactTitle,
+		Path:         urlPath,
+	}
+
+	if code == http.StatusNotFound {
+		data.Title = text.NotFoundTitle
+		data.Message = text.NotFoundMessage
+	}
+
+	if len(contacts) > 0 {
+		contact := contacts[matchTag(tag, contacts)]
+		data.Contact = &contact
+	}
+
+	return data
+}
+
+// Send an error to the HTTP client as a JSON object.
+func writeJSONError(w http.ResponseWriter, data ErrorTemplate) {
+	body := struct {
+		Error struct {
+			Code     int      `json:"code"`
+			Status   string   `json:"status"`
+			Message  string   `json:"message"`
+			Language string   `json:"language"`
+			Contact  *Contact `json:"contact,omitempty"`
+		} `json:"error"`
+	}{}
+
+	body.Error.Code = data.Code
+	body.Error.Status = data.Status
+	body.Error.Message = data.Message
+	body.Error.Language = data.Language
+	body.Error.Contact = data.Contact
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(data.Code)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Return the template for an error page with code.
+//
+// A 404.html or error.html template in fsys is used when it exists.
+func findErrorTemplate(fsys fs.FS, code int) (*template.Template, error) {
+	templateNames := []string{errorTemplateFileName}
+	if code == http.StatusNotFound {
+		templateNames = []string{notFoundTemplateFileName, errorTemplateFileName}
+	}
+
+	for _, name := range templateNames {
+		if _, err := fs.Stat(fsys, name); err == nil {
+			return template.New(name).ParseFS(fsys, name)
+		}
+	}
+
+	return template.New(errorTemplateFileName).ParseFS(defaults.DefaultTemplates, errorTemplateFileName)
+}
+
+// Read the contact details for the campaign in urlPath, or the default contact details.
+//
+// Contact details are read from contact.json, which contains contact details per language.
+// An empty map is returned if there are no contact details.
+func readContacts(fsys fs.FS, urlPath string) map[language.Tag]Contact {
+	var filePaths []string
+
+	campaign := parser.CampaignFromPath(urlPath)
+	if campaign != "" {
+		filePaths = append(filePaths, path.Join("campaigns", campaign, contactFileName))
+	}
+	filePaths = append(filePaths, contactFileName)
+
+	for _, filePath := range filePaths {
+		data, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			continue
+		}
+
+		var contacts map[string]Contact
+		err = json.Unmarshal(data, &contacts)
+		if err != nil {
+			log.Println("error reading", filePath+":", err)
+			continue
+		}
+
+		tags := make(map[language.Tag]Contact, len(contacts))
+		for lang, contact := range contacts {
+			tag, err := language.Parse(lang)
+			if err != nil {
+				continue
+			}
+			tags[tag] = contact
+		}
+
+		return tags
+	}
+
+	return map[language.Tag]Contact{}
+}
+
+// Returns if the client prefers a JSON response over HTML, based on the Accept header.
+func prefersJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html", "application/xhtml+xml":
+			return false
+		}
+	}
+
+	return false
+}
+
+// Return the key in options that best matches tag.
+func matchTag[T any](tag language.Tag, options map[language.Tag]T) language.Tag {
+	var tags []language.Tag
+	for option := range options {
+		tags = append(tags, option)
+	}
+	sortTags(tags)
+
+	_, index, _ := language.NewMatcher(tags).Match(tag)
+	return tags[index]
+}
+
+// Sort tags alphabetically, so the order is deterministic.
+func sortTags(tags []language.Tag) {
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].String() < tags[j].String()
+	})
+}
@@ -3,11 +3,15 @@ module github.com/energietransitie/needforheat-manual-server
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/andybalholm/brotli v1.0.5
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/go-chi/chi v1.5.4
 	github.com/go-git/go-git/v5 v5.8.1
 	github.com/gomarkdown/markdown v0.0.0-20230716120725-531d2d74bc12
 	golang.org/x/sync v0.3.0
 	golang.org/x/text v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -1,6 +1,7 @@
 package needforheatmanualserver
 
 import (
+	"errors"
 	"log"
 	"net/http"
 )
@@ -12,6 +13,9 @@ type HandlerError struct {
 }
 
 func (e HandlerError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Code)
+	}
 	return e.Err.Error()
 }
 
@@ -23,24 +27,36 @@ func NewHandlerError(err error, code int) *HandlerError {
 	}
 }
 
+// An ErrorWriter sends an error with code to the HTTP client.
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, code int)
+
 // A Handler is an http.HandlerFunc that can return an error.
 type Handler func(w http.ResponseWriter, r *http.Request) error
 
 // Implement the http.Handler interface.
 func (fn Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := fn(w, r)
+	fn.WithErrorWriter(func(w http.ResponseWriter, r *http.Request, code int) {
+		HTTPError(w, code)
+	}).ServeHTTP(w, r)
+}
 
-	if err != nil {
-		log.Println(err)
+// Return an http.Handler that sends errors returned by fn to the HTTP client using writeError.
+func (fn Handler) WithErrorWriter(writeError ErrorWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r)
 
-		handlerErr, ok := err.(*HandlerError)
-		if !ok {
-			HTTPError(w, http.StatusInternalServerError)
-			return
-		}
+		if err != nil {
+			log.Println(err)
 
-		HTTPError(w, handlerErr.Code)
-	}
+			var handlerErr *HandlerError
+			if !errors.As(err, &handlerErr) {
+				writeError(w, r, http.StatusInternalServerError)
+				return
+			}
+
+			writeError(w, r, handlerErr.Code)
+		}
+	})
 }
 
 // Send an error to the HTTP client with the status text and code.
@@ -1,14 +1,26 @@
 package needforheatmanualserver
 
 import (
-	"errors"
 	"io/fs"
+	"log"
+	"net/http"
+	"strings"
 
+	"github.com/energietransitie/needforheat-manual-server/parser"
 	"golang.org/x/text/language"
 )
 
-var (
-	ErrFallbackInvalid = errors.New("fallback is invalid")
+const (
+	// Header that tells how well the chosen language matches the client's languages:
+	// exact, high, low or no (when the fallback language was chosen).
+	languageConfidenceHeader = "X-Language-Confidence"
+
+	// Query parameter that overrides the languages of the client (e.g. ?lang=nl-NL).
+	languageParam = "lang"
+
+	// Cookie that persists the language set with the lang parameter.
+	languageCookieName   = "nfh_lang"
+	languageCookieMaxAge = 365 * 24 * 60 * 60
 )
 
 // Parse all the available languages of files in a folder.
@@ -37,47 +49,99 @@ func ParseLanguageFiles(fsys fs.FS, folder string) ([]language.Tag, error) {
 	return langs, nil
 }
 
+// Choose one of options for a client that prefers the languages in preferences,
+// which are language codes or Accept-Language headers in order of priority.
+//
+// Options are matched in the order of parser.SortLanguages with fallbacks, so when a client's
+// languages match several options equally well, the one that comes first in fallbacks is chosen.
+// When none of the client's languages match, the first option in that order is chosen:
+// the first available language in fallbacks, or else the first available language alphabetically.
+//
+// The confidence of the match is returned as well. It is language.No when the fallback was chosen.
+// language.Und is returned when there are no options.
+func ChooseLanguage(options []language.Tag, fallbacks []language.Tag, preferences ...string) (language.Tag, language.Confidence) {
+	if len(options) == 0 {
+		return language.Und, language.No
+	}
+
+	options = parser.SortLanguages(options, fallbacks)
+
+	var desired []language.Tag
+	for _, preference := range preferences {
+		tags, _, err := language.ParseAcceptLanguage(preference)
+		if err != nil {
+			continue
+		}
+		desired = append(desired, tags...)
+	}
+
+	_, index, confidence := language.NewMatcher(options).Match(desired...)
+
+	return options[index], confidence
+}
+
 // Choose which file to show from options based on the Language-Accept header.
 // Fallback will be chosen when the Language-Accept header does not contain an available language.
 //
 // The file name will be returned.
+//
+// Deprecated: Use [ChooseLanguage], which supports several fallback languages.
 func ChooseFile(options []language.Tag, fallback language.Tag, acceptLangHeader string) (string, error) {
-	if optionsContainFallback(options, fallback) {
-		options = setCorrectFallbackOrder(options, fallback)
+	tag, _ := ChooseLanguage(options, []language.Tag{fallback}, acceptLangHeader)
+	return tag.String(), nil
+}
+
+// Choose one of options for the manual or page at urlPath and set the X-Language-Confidence header of w.
+//
+// The fallback languages of the campaign in urlPath are preferred over the fallback languages of the server.
+func (s *Server) chooseLanguage(w http.ResponseWriter, fsys fs.FS, urlPath string, options []language.Tag, preferences ...string) language.Tag {
+	fallbacks, err := parser.CampaignFallbackLanguages(fsys, parser.CampaignFromPath(urlPath))
+	if err != nil {
+		log.Println("error reading fallback languages:", err)
 	}
+	fallbacks = append(fallbacks, s.options.FallbackLanguages...)
 
-	matcher := language.NewMatcher(options)
+	lang, confidence := ChooseLanguage(options, fallbacks, preferences...)
 
-	tag, _ := language.MatchStrings(matcher, acceptLangHeader)
+	w.Header().Set(languageConfidenceHeader, strings.ToLower(confidence.String()))
 
-	return tag.String(), nil
+	return lang
 }
 
-func optionsContainFallback(options []language.Tag, fallback language.Tag) bool {
-	var present bool
+// Return the languages the client of r prefers, in order of priority:
+// the lang parameter, the language cookie and the Accept-Language header.
+func (s *Server) languagePreferences(r *http.Request) []string {
+	preferences := []string{r.URL.Query().Get(languageParam)}
 
-	for _, tag := range options {
-		if tag == fallback {
-			present = true
-			break
+	if s.options.LanguageCookie {
+		cookie, err := r.Cookie(languageCookieName)
+		if err == nil {
+			preferences = append(preferences, cookie.Value)
 		}
 	}
 
-	return present
+	return append(preferences, r.Header.Get("Accept-Language"))
 }
 
-func setCorrectFallbackOrder(options []language.Tag, fallback language.Tag) []language.Tag {
-	if options[0] == fallback {
-		return options
+// Persist the language set with the lang parameter of r in the language cookie,
+// if the language cookie is enabled and the language is valid. Returns if the cookie was set.
+func (s *Server) setLanguageCookie(w http.ResponseWriter, r *http.Request) bool {
+	if !s.options.LanguageCookie {
+		return false
 	}
 
-	for i := range options {
-		if options[i] == fallback {
-			// Swap i and first index in slice.
-			options[0], options[i] = options[i], options[0]
-			break
-		}
+	tag, err := language.Parse(r.URL.Query().Get(languageParam))
+	if err != nil {
+		return false
 	}
 
-	return options
+	http.SetCookie(w, &http.Cookie{
+		Name:     languageCookieName,
+		Value:    tag.String(),
+		Path:     "/",
+		MaxAge:   languageCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return true
 }
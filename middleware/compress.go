@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content types that are compressed, because they contain text.
+var compressibleContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// Compress compresses responses with gzip at level, for clients that accept it.
+// Only text responses are compressed, and responses that already have a Content-Encoding,
+// like precompressed files, are left as they are.
+//
+// A strong ETag of a compressed response is made weak, because the compressed bytes differ from the original.
+func Compress(level int) func(http.Handler) http.Handler {
+	pool := sync.Pool{
+		New: func() any {
+			gw, err := gzip.NewWriterLevel(io.Discard, level)
+			if err != nil {
+				gw = gzip.NewWriter(io.Discard)
+			}
+			return gw
+		},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{
+				ResponseWriter: w,
+				pool:           &pool,
+				accepted:       AcceptsEncoding(r, "gzip"),
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// AcceptsEncoding reports whether the Accept-Encoding header of r accepts the content coding name.
+func AcceptsEncoding(r *http.Request, name string) bool {
+	accepted := false
+
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(coding, ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+
+			if coding != name && coding != "*" {
+				continue
+			}
+
+			ok := qualityAbove0(params)
+			if coding == name {
+				// An explicit coding wins from the wildcard.
+				return ok
+			}
+			accepted = ok
+		}
+	}
+
+	return accepted
+}
+
+// Report whether the parameters of a coding in an Accept-Encoding header have a quality above 0.
+func qualityAbove0(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.ToLower(key) != "q" {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return err == nil && q > 0
+	}
+
+	return true
+}
+
+// A compressWriter decides whether to compress a response when the header is written.
+type compressWriter struct {
+	http.ResponseWriter
+	pool *sync.Pool
+
+	// The client accepts gzip.
+	accepted bool
+
+	wroteHeader bool
+	gw          *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.wroteHeader {
+		cw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	if compressible(header, statusCode) {
+		addVary(header, "Accept-Encoding")
+
+		if cw.accepted {
+			header.Set("Content-Encoding", "gzip")
+			header.Del("Content-Length")
+
+			if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				header.Set("ETag", "W/"+etag)
+			}
+
+			cw.gw = cw.pool.Get().(*gzip.Writer)
+			cw.gw.Reset(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.gw != nil {
+		return cw.gw.Write(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.gw != nil {
+		cw.gw.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	return hj.Hijack()
+}
+
+// Finish the compressed response, if any, and return the gzip writer to the pool.
+func (cw *compressWriter) close() {
+	if cw.gw == nil {
+		return
+	}
+
+	cw.gw.Close()
+	cw.gw.Reset(io.Discard)
+	cw.pool.Put(cw.gw)
+	cw.gw = nil
+}
+
+// Report whether a response with header and statusCode can be compressed.
+func compressible(header http.Header, statusCode int) bool {
+	switch statusCode {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, prefix := range compressibleContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add value to the Vary header, unless it is already listed.
+func addVary(header http.Header, value string) {
+	for _, vary := range header.Values("Vary") {
+		for _, v := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", value)
+}
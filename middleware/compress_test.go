@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("<p>Steek de kabel in de P1-poort.</p>\n", 20)
+
+	handler := Compress(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Add("Vary", "Accept-Language")
+		if r.URL.Path == "/precompressed/" {
+			w.Header().Set("Content-Encoding", "br")
+		}
+		io.WriteString(w, body)
+	}))
+
+	serve := func(path, acceptEncoding string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	resp := serve("/", "br;q=1.0, gzip;q=0.8")
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("ETag") != `W/"abc"` {
+		t.Fatalf("expected a gzip response with a weak ETag, got %v", resp.Header)
+	}
+
+	if vary := resp.Header.Values("Vary"); len(vary) != 2 || vary[0] != "Accept-Language" {
+		t.Errorf("expected Accept-Encoding to be added to the Vary header, got %v", vary)
+	}
+
+	r, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != body {
+		t.Errorf("expected the decompressed body to be the original body")
+	}
+
+	resp = serve("/", "gzip;q=0, *")
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("expected no compression when gzip is refused")
+	}
+
+	resp = serve("/precompressed/", "gzip, br")
+	if resp.Header.Get("Content-Encoding") != "br" || resp.Header.Get("ETag") != `"abc"` {
+		t.Errorf("expected a precompressed response to be left as it is, got %v", resp.Header)
+	}
+}
@@ -0,0 +1,295 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+const (
+	// Username used for HTTP authentication when only a password or token is set.
+	// Most git servers (e.g. GitHub) accept any username when a token is used.
+	defaultHTTPUsername = "git"
+
+	// Username used for SSH authentication when the URL does not contain one.
+	defaultSSHUsername = "git"
+)
+
+// Returned when a password or token is set for a repository with an http:// URL,
+// which would send it to the git server unencrypted.
+var ErrInsecureCredentials = errors.New("credentials are not sent over http, use https")
+
+// A Credential contains what is needed to authenticate with a git server.
+type Credential struct {
+	// Username for HTTP basic authentication or SSH.
+	Username string
+
+	// Password or (personal access) token for HTTP basic authentication.
+	Password string
+
+	// Path to a private key file for SSH authentication.
+	SSHKeyFile string
+
+	// Passphrase for the private key in SSHKeyFile, if it is encrypted.
+	SSHKeyPassphrase string
+
+	// Path to a known_hosts file that is used to check the host key of an SSH server.
+	// When empty, the file in the SSH_KNOWN_HOSTS environment variable or ~/.ssh/known_hosts is used.
+	KnownHostsFile string
+}
+
+// Credentials are used to authenticate with git servers.
+//
+// Credentials for a specific host (e.g. 'github.com') or repository path on a host
+// (e.g. 'github.com/energietransitie') are used when they match a repository URL.
+// The longest match is used. When nothing matches, Default is used.
+type Credentials struct {
+	Default Credential
+	Hosts   map[string]Credential
+}
+
+// Return the authentication method to use for the git repository at url.
+//
+// A nil transport.AuthMethod is returned if no credentials are set for url.
+// ErrInsecureCredentials is returned if a password is set for an http:// URL.
+func (c *Credentials) AuthMethod(url string) (transport.AuthMethod, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := c.find(endpoint)
+
+	switch endpoint.Protocol {
+	case "http", "https":
+		if credential.Password == "" {
+			return nil, nil
+		}
+
+		if endpoint.Protocol == "http" {
+			return nil, fmt.Errorf("%w: %s", ErrInsecureCredentials, endpoint.Host)
+		}
+
+		username := credential.Username
+		if username == "" {
+			username = defaultHTTPUsername
+		}
+
+		return &http.BasicAuth{
+			Username: username,
+			Password: credential.Password,
+		}, nil
+	case "ssh":
+		if credential.SSHKeyFile == "" {
+			return nil, nil
+		}
+
+		username := credential.Username
+		if endpoint.User != "" {
+			username = endpoint.User
+		}
+		if username == "" {
+			username = defaultSSHUsername
+		}
+
+		auth, err := ssh.NewPublicKeysFromFile(username, credential.SSHKeyFile, credential.SSHKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		if credential.KnownHostsFile != "" {
+			auth.HostKeyCallback, err = ssh.NewKnownHostsCallback(credential.KnownHostsFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return auth, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Return the credential with the longest host or path match for endpoint.
+func (c *Credentials) find(endpoint *transport.Endpoint) Credential {
+	repoPath := endpoint.Host + "/" + strings.Trim(endpoint.Path, "/")
+
+	var (
+		match       Credential
+		matchLength = -1
+	)
+
+	for prefix, credential := range c.Hosts {
+		prefix = strings.Trim(prefix, "/")
+
+		if repoPath != prefix && !strings.HasPrefix(repoPath, prefix+"/") {
+			continue
+		}
+
+		if len(prefix) > matchLength {
+			match = credential
+			matchLength = len(prefix)
+		}
+	}
+
+	if matchLength < 0 {
+		return c.Default
+	}
+
+	return match
+}
+
+// Get credentials from environment variables.
+//
+// Default credentials are set by environment variables:
+//   - NFH_GIT_USERNAME: username for HTTP or SSH authentication.
+//   - NFH_GIT_PASSWORD: password or token for HTTP authentication.
+//   - NFH_GIT_SSH_KEY_FILE: path to a private key for SSH authentication.
+//   - NFH_GIT_SSH_KEY_PASSPHRASE: passphrase for the private key.
+//   - NFH_GIT_KNOWN_HOSTS_FILE: path to a known_hosts file to check SSH host keys.
+//
+// Secrets can also be read from a file (e.g. a Docker secret) by adding _FILE
+// to the name of the environment variable (e.g. NFH_GIT_PASSWORD_FILE).
+//
+// Credentials for specific hosts are read from a JSON file set by environment variable NFH_GIT_CREDENTIALS_FILE.
+func CredentialsFromEnv() (*Credentials, error) {
+	return CredentialsFromLookup(os.LookupEnv)
+}
+
+// Get credentials from the settings lookup returns, by the names of the environment variables of CredentialsFromEnv.
+// lookup returns the value of a setting and if it was set, like os.LookupEnv.
+func CredentialsFromLookup(lookup func(key string) (string, bool)) (*Credentials, error) {
+	password, err := lookupSecret(lookup, "NFH_GIT_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := lookupSecret(lookup, "NFH_GIT_SSH_KEY_PASSPHRASE")
+	if err != nil {
+		return nil, err
+	}
+
+	username, _ := lookup("NFH_GIT_USERNAME")
+	sshKeyFile, _ := lookup("NFH_GIT_SSH_KEY_FILE")
+	knownHostsFile, _ := lookup("NFH_GIT_KNOWN_HOSTS_FILE")
+
+	credentials := &Credentials{
+		Default: Credential{
+			Username:         username,
+			Password:         password,
+			SSHKeyFile:       sshKeyFile,
+			SSHKeyPassphrase: passphrase,
+			KnownHostsFile:   knownHostsFile,
+		},
+	}
+
+	credentialsFile, ok := lookup("NFH_GIT_CREDENTIALS_FILE")
+	if ok {
+		credentials.Hosts, err = ReadCredentialsFile(credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return credentials, nil
+}
+
+// Get the value of the setting named by key,
+// or read it from the file set by the setting named key_FILE.
+func lookupSecret(lookup func(key string) (string, bool), key string) (string, error) {
+	value, ok := lookup(key)
+	if ok {
+		return value, nil
+	}
+
+	filePath, _ := lookup(key + "_FILE")
+	return readSecret("", filePath)
+}
+
+// Read per-host credentials from a JSON file at filePath.
+//
+// The file contains an object with a host or repository path on a host as keys
+// and a credential as values:
+//
+//	{
+//	  "github.com/energietransitie": {
+//	    "username": "needforheat",
+//	    "password_file": "/run/secrets/github_token"
+//	  },
+//	  "gitlab.com": {
+//	    "ssh_key_file": "/run/secrets/gitlab_key",
+//	    "known_hosts_file": "/etc/ssh/known_hosts"
+//	  }
+//	}
+//
+// Secrets can be set directly, or read from a file using the '_file' variant of a field.
+func ReadCredentialsFile(filePath string) (map[string]Credential, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]struct {
+		Username             string `json:"username"`
+		Password             string `json:"password"`
+		PasswordFile         string `json:"password_file"`
+		SSHKeyFile           string `json:"ssh_key_file"`
+		SSHKeyPassphrase     string `json:"ssh_key_passphrase"`
+		SSHKeyPassphraseFile string `json:"ssh_key_passphrase_file"`
+		KnownHostsFile       string `json:"known_hosts_file"`
+	}
+
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make(map[string]Credential, len(entries))
+
+	for host, entry := range entries {
+		password, err := readSecret(entry.Password, entry.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+
+		passphrase, err := readSecret(entry.SSHKeyPassphrase, entry.SSHKeyPassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts[host] = Credential{
+			Username:         entry.Username,
+			Password:         password,
+			SSHKeyFile:       entry.SSHKeyFile,
+			SSHKeyPassphrase: passphrase,
+			KnownHostsFile:   entry.KnownHostsFile,
+		}
+	}
+
+	return hosts, nil
+}
+
+// Return value, or the contents of the file at filePath if value is empty.
+// Trailing newlines are removed from the contents of the file.
+func readSecret(value string, filePath string) (string, error) {
+	if value != "" || filePath == "" {
+		return value, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+func TestCredentialsAuthMethod(t *testing.T) {
+	credentials := &Credentials{
+		Default: Credential{Password: "default-token"},
+		Hosts: map[string]Credential{
+			"github.com":                   {Password: "github-token"},
+			"github.com/energietransitie/": {Username: "nfh", Password: "org-token"},
+			"gitlab.com":                   {},
+		},
+	}
+
+	testAuthMethod(t, credentials, "https://github.com/other/repo.git", "git", "github-token")
+	testAuthMethod(t, credentials, "https://github.com/energietransitie/repo.git", "nfh", "org-token")
+	testAuthMethod(t, credentials, "https://github.com/energietransitie-fork/repo.git", "git", "github-token")
+	testAuthMethod(t, credentials, "https://example.com/repo.git", "git", "default-token")
+	testAuthMethod(t, credentials, "https://gitlab.com/org/repo.git", "", "")
+	testAuthMethod(t, credentials, "file:///tmp/repo.git", "", "")
+	testAuthMethod(t, nil, "https://github.com/other/repo.git", "", "")
+	testAuthMethod(t, credentials, "http://gitlab.com/org/repo.git", "", "")
+
+	_, err := credentials.AuthMethod("http://github.com/other/repo.git")
+	if !errors.Is(err, ErrInsecureCredentials) {
+		t.Errorf("expected %v for an http:// URL, got %v", ErrInsecureCredentials, err)
+	}
+}
+
+func TestReadCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tokenFile := filepath.Join(dir, "token")
+	err := os.WriteFile(tokenFile, []byte("secret-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialsFile := filepath.Join(dir, "credentials.json")
+	err = os.WriteFile(credentialsFile, []byte(`{"github.com": {"username": "nfh", "password_file": "`+tokenFile+`"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := ReadCredentialsFile(credentialsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hosts["github.com"].Password != "secret-token" {
+		t.Fatalf("expected password %q, got %q", "secret-token", hosts["github.com"].Password)
+	}
+}
+
+func testAuthMethod(t *testing.T, credentials *Credentials, url string, expectedUsername string, expectedPassword string) {
+	t.Run(url, func(t *testing.T) {
+		auth, err := credentials.AuthMethod(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expectedPassword == "" {
+			if auth != nil {
+				t.Fatalf("expected no authentication, got %s", auth)
+			}
+			return
+		}
+
+		basicAuth, ok := auth.(*http.BasicAuth)
+		if !ok {
+			t.Fatalf("expected basic authentication, got %T", auth)
+		}
+
+		if basicAuth.Username != expectedUsername || basicAuth.Password != expectedPassword {
+			t.Fatalf("expected %s:%s, got %s:%s", expectedUsername, expectedPassword, basicAuth.Username, basicAuth.Password)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package parser
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+)
+
+const (
+	// Name of the file at the root of a generation that lists all parsed manuals.
+	CatalogFileName = "catalog.json"
+)
+
+// A Catalog lists all manuals in a generation, so they can be discovered without walking the filesystem.
+type Catalog struct {
+	Devices       []CatalogEntity   `json:"devices"`
+	EnergyQueries []CatalogEntity   `json:"energy_queries"`
+	CloudFeeds    []CatalogEntity   `json:"cloud_feeds"`
+	Campaigns     []CatalogCampaign `json:"campaigns"`
+}
+
+// A CatalogEntity is a device, energy query or cloud feed that has manuals.
+type CatalogEntity struct {
+	Name         string              `json:"name"`
+	URL          string              `json:"url"`
+	DisplayNames map[string]string   `json:"display_names"`
+	ManualTypes  []CatalogManualType `json:"manual_types"`
+}
+
+// A CatalogManualType contains the manuals of one type (e.g. installation) for an entity, per campaign.
+type CatalogManualType struct {
+	Name      string          `json:"name"`
+	URL       string          `json:"url"`
+	Campaigns []CatalogManual `json:"campaigns"`
+}
+
+// A CatalogCampaign contains the manuals of a campaign.
+type CatalogCampaign struct {
+	Name        string          `json:"name"`
+	ManualTypes []CatalogManual `json:"manual_types"`
+}
+
+// A CatalogManual is a manual that is available in one or more languages.
+//
+// Name is the name of the campaign for manuals of an entity,
+// or the name of the manual type for manuals of a campaign.
+// URL redirects to the language that best matches the client.
+type CatalogManual struct {
+	Name      string            `json:"name"`
+	URL       string            `json:"url"`
+	Languages []CatalogLanguage `json:"languages"`
+}
+
+// A CatalogLanguage is a manual in a specific language.
+type CatalogLanguage struct {
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+}
+
+// catalogBuilder collects manuals and display names while parsing, to create a Catalog.
+type catalogBuilder struct {
+	// Entities by category and name.
+	entities map[string]map[string]*catalogEntity
+
+	// Manual types by campaign name.
+	campaigns map[string]map[string][]CatalogLanguage
+}
+
+type catalogEntity struct {
+	displayNames map[string]string
+
+	// Languages by manual type and campaign.
+	manuals map[string]map[string][]CatalogLanguage
+}
+
+func newCatalogBuilder() *catalogBuilder {
+	return &catalogBuilder{
+		entities:  map[string]map[string]*catalogEntity{},
+		campaigns: map[string]map[string][]CatalogLanguage{},
+	}
+}
+
+// Add the display names of the entity that the display_names.json file at destFilePath belongs to.
+func (b *catalogBuilder) addDisplayNames(destFilePath string, displayNames map[string]string) {
+	// e.g. devices/<device>/display_names.json
+	splitPath := strings.Split(destFilePath, "/")
+	if len(splitPath) != 3 || !displayNameCategories[splitPath[0]] {
+		return
+	}
+
+	b.entity(splitPath[0], splitPath[1]).displayNames = displayNames
+}
+
+// Add the manual at destFilePath in lang with title.
+func (b *catalogBuilder) addManual(destFilePath string, lang string, title string) {
+	// e.g. devices/<device>/<manual_type>/<campaign>/languages/<lang>.md
+	// or campaigns/<campaign>/<manual_type>/languages/<lang>.md
+	splitPath := strings.Split(destFilePath, "/")
+
+	manualPath := strings.Join(splitPath[:len(splitPath)-2], "/")
+	language := CatalogLanguage{
+		Language: lang,
+		Title:    title,
+		URL:      "/" + manualPath + "/" + lang + "/",
+	}
+
+	switch {
+	case len(splitPath) == 6 && displayNameCategories[splitPath[0]]:
+		entity := b.entity(splitPath[0], splitPath[1])
+
+		manualType, campaign := splitPath[2], splitPath[3]
+		if entity.manuals[manualType] == nil {
+			entity.manuals[manualType] = map[string][]CatalogLanguage{}
+		}
+		entity.manuals[manualType][campaign] = append(entity.manuals[manualType][campaign], language)
+	case len(splitPath) == 5 && splitPath[0] == "campaigns":
+		campaign, manualType := splitPath[1], splitPath[2]
+		if b.campaigns[campaign] == nil {
+			b.campaigns[campaign] = map[string][]CatalogLanguage{}
+		}
+		b.campaigns[campaign][manualType] = append(b.campaigns[campaign][manualType], language)
+	}
+}
+
+// Return the entity in category with name, creating it if it does not exist.
+func (b *catalogBuilder) entity(category string, name string) *catalogEntity {
+	if b.entities[category] == nil {
+		b.entities[category] = map[string]*catalogEntity{}
+	}
+
+	entity, ok := b.entities[category][name]
+	if !ok {
+		entity = &catalogEntity{
+			displayNames: map[string]string{},
+			manuals:      map[string]map[string][]CatalogLanguage{},
+		}
+		b.entities[category][name] = entity
+	}
+
+	return entity
+}
+
+// Create the Catalog. Everything in it is sorted by name.
+func (b *catalogBuilder) build() Catalog {
+	catalog := Catalog{
+		Devices:       b.buildEntities("devices"),
+		EnergyQueries: b.buildEntities("energy_queries"),
+		CloudFeeds:    b.buildEntities("cloud_feeds"),
+		Campaigns:     []CatalogCampaign{},
+	}
+
+	for _, campaignName := range sortedKeys(b.campaigns) {
+		campaign := CatalogCampaign{
+			Name:        campaignName,
+			ManualTypes: buildManuals("/campaigns/"+campaignName+"/", b.campaigns[campaignName]),
+		}
+		catalog.Campaigns = append(catalog.Campaigns, campaign)
+	}
+
+	return catalog
+}
+
+// Create the entities in category.
+func (b *catalogBuilder) buildEntities(category string) []CatalogEntity {
+	entities := []CatalogEntity{}
+
+	for _, name := range sortedKeys(b.entities[category]) {
+		entity := b.entities[category][name]
+		entityURL := "/" + category + "/" + name + "/"
+
+		catalogEntity := CatalogEntity{
+			Name:         name,
+			URL:          entityURL,
+			DisplayNames: entity.displayNames,
+			ManualTypes:  []CatalogManualType{},
+		}
+
+		for _, manualType := range sortedKeys(entity.manuals) {
+			manualTypeURL := entityURL + manualType + "/"
+
+			catalogEntity.ManualTypes = append(catalogEntity.ManualTypes, CatalogManualType{
+				Name:      manualType,
+				URL:       manualTypeURL,
+				Campaigns: buildManuals(manualTypeURL, entity.manuals[manualType]),
+			})
+		}
+
+		entities = append(entities, catalogEntity)
+	}
+
+	return entities
+}
+
+// Create manuals from languages by name, with URLs starting with baseURL.
+func buildManuals(baseURL string, manuals map[string][]CatalogLanguage) []CatalogManual {
+	catalogManuals := []CatalogManual{}
+
+	for _, name := range sortedKeys(manuals) {
+		languages := manuals[name]
+		sort.Slice(languages, func(i, j int) bool {
+			return languages[i].Language < languages[j].Language
+		})
+
+		catalogManuals = append(catalogManuals, CatalogManual{
+			Name:      name,
+			URL:       baseURL + name + "/",
+			Languages: languages,
+		})
+	}
+
+	return catalogManuals
+}
+
+// Write the catalog to the staging filesystem.
+func (p *Parser) writeCatalog() error {
+	data, err := json.MarshalIndent(p.catalog.build(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return wfs.WriteFile(p.stagingFS, CatalogFileName, data, 0644)
+}
+
+// Return the keys of m in alphabetical order.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
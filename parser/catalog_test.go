@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCatalogBuilder(t *testing.T) {
+	builder := newCatalogBuilder()
+
+	builder.addDisplayNames("devices/smart-meter/display_names.json", map[string]string{"en-US": "Smart meter module"})
+	builder.addDisplayNames("cloud_feeds/enelogic/display_names.json", map[string]string{"en-US": "Enelogic"})
+	builder.addManual("devices/smart-meter/installation/generic/languages/nl-NL.md", "nl-NL", "Installatie")
+	builder.addManual("devices/smart-meter/installation/generic/languages/en-US.md", "en-US", "Installation")
+	builder.addManual("campaigns/generic/faq/languages/en-US.md", "en-US", "FAQ")
+
+	expected := Catalog{
+		Devices: []CatalogEntity{
+			{
+				Name:         "smart-meter",
+				URL:          "/devices/smart-meter/",
+				DisplayNames: map[string]string{"en-US": "Smart meter module"},
+				ManualTypes: []CatalogManualType{
+					{
+						Name: "installation",
+						URL:  "/devices/smart-meter/installation/",
+						Campaigns: []CatalogManual{
+							{
+								Name: "generic",
+								URL:  "/devices/smart-meter/installation/generic/",
+								Languages: []CatalogLanguage{
+									{Language: "en-US", Title: "Installation", URL: "/devices/smart-meter/installation/generic/en-US/"},
+									{Language: "nl-NL", Title: "Installatie", URL: "/devices/smart-meter/installation/generic/nl-NL/"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		EnergyQueries: []CatalogEntity{},
+		CloudFeeds: []CatalogEntity{
+			{
+				Name:         "enelogic",
+				URL:          "/cloud_feeds/enelogic/",
+				DisplayNames: map[string]string{"en-US": "Enelogic"},
+				ManualTypes:  []CatalogManualType{},
+			},
+		},
+		Campaigns: []CatalogCampaign{
+			{
+				Name: "generic",
+				ManualTypes: []CatalogManual{
+					{
+						Name: "faq",
+						URL:  "/campaigns/generic/faq/",
+						Languages: []CatalogLanguage{
+							{Language: "en-US", Title: "FAQ", URL: "/campaigns/generic/faq/en-US/"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	catalog := builder.build()
+	if !reflect.DeepEqual(catalog, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, catalog)
+	}
+}
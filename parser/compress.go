@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+
+	"github.com/andybalholm/brotli"
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+)
+
+const (
+	DefaultGzipLevel   = gzip.BestCompression
+	DefaultBrotliLevel = 9
+
+	// Files smaller than this are not compressed, because it would not make them smaller.
+	minCompressSize = 256
+)
+
+var (
+	ErrCompressionLevelInvalid = errors.New("compression level is invalid")
+)
+
+// Extensions of files that are compressed, because they contain text.
+var compressibleExtensions = map[string]bool{
+	".html": true,
+	".css":  true,
+	".js":   true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+}
+
+// An Encoding is a format files are precompressed in.
+// A precompressed file is stored next to the original file, with the extension of the encoding added.
+type Encoding struct {
+	// Name of the encoding in the Accept-Encoding and Content-Encoding headers.
+	Name string
+	// Extension added to the name of a precompressed file.
+	Extension string
+}
+
+var (
+	EncodingBrotli = Encoding{Name: "br", Extension: ".br"}
+	EncodingGzip   = Encoding{Name: "gzip", Extension: ".gz"}
+)
+
+// Encodings of precompressed files, from most to least preferred.
+var Encodings = []Encoding{EncodingBrotli, EncodingGzip}
+
+// CompressionOptions sets how generated text files (HTML, CSS, JavaScript, JSON, SVG and plain text)
+// are precompressed, so they can be served compressed without compressing them for every request.
+type CompressionOptions struct {
+	// Level of the .gz files, from 1 (fastest) to 9 (smallest).
+	// DefaultGzipLevel is used when it is 0, and no .gz files are written when it is negative.
+	GzipLevel int
+
+	// Level of the .br files, from 1 (fastest) to 11 (smallest).
+	// DefaultBrotliLevel is used when it is 0, and no .br files are written when it is negative.
+	BrotliLevel int
+}
+
+// Return an error if a level of o is out of range.
+func (o CompressionOptions) Validate() error {
+	if o.GzipLevel > gzip.BestCompression {
+		return fmt.Errorf("%w: gzip level must be at most %d", ErrCompressionLevelInvalid, gzip.BestCompression)
+	}
+
+	if o.BrotliLevel > brotli.BestCompression {
+		return fmt.Errorf("%w: brotli level must be at most %d", ErrCompressionLevelInvalid, brotli.BestCompression)
+	}
+
+	return nil
+}
+
+// Return the level of encoding, or false if files are not compressed with it.
+func (o CompressionOptions) level(encoding Encoding) (int, bool) {
+	level, defaultLevel := o.GzipLevel, DefaultGzipLevel
+	if encoding == EncodingBrotli {
+		level, defaultLevel = o.BrotliLevel, DefaultBrotliLevel
+	}
+
+	if level < 0 {
+		return 0, false
+	}
+	if level == 0 {
+		return defaultLevel, true
+	}
+
+	return level, true
+}
+
+// Write a precompressed file next to every text file in the staging filesystem,
+// for every encoding that is enabled. A precompressed file is only written when it is smaller.
+//
+// Files that did not change since the current generation reuse its precompressed files.
+func (p *Parser) compressFiles() error {
+	var (
+		currentFS       fs.FS
+		currentManifest Manifest
+	)
+	if p.current != "" {
+		currentFS, _ = p.Current()
+		currentManifest, _ = ReadManifest(currentFS)
+	}
+
+	return fs.WalkDir(p.stagingFS, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !compressibleExtensions[path.Ext(filePath)] {
+			return err
+		}
+
+		data, err := fs.ReadFile(p.stagingFS, filePath)
+		if err != nil || len(data) < minCompressSize {
+			return err
+		}
+
+		unchanged := currentManifest[filePath].Hash == hashData(data)
+
+		for _, encoding := range Encodings {
+			level, ok := p.options.Compression.level(encoding)
+			if !ok {
+				continue
+			}
+
+			var compressed []byte
+			if unchanged {
+				compressed, _ = fs.ReadFile(currentFS, filePath+encoding.Extension)
+			}
+			if compressed == nil {
+				compressed, err = compress(data, encoding, level)
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(compressed) >= len(data) {
+				continue
+			}
+
+			err = wfs.WriteFile(p.stagingFS, filePath+encoding.Extension, compressed, 0644)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Compress data with encoding at level.
+func compress(data []byte, encoding Encoding, level int) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+		err error
+	)
+
+	switch encoding {
+	case EncodingBrotli:
+		w = brotli.NewWriterLevel(&buf, level)
+	default:
+		w, err = gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+func TestCompressFiles(t *testing.T) {
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/nl-NL.md": "# Veelgestelde vragen\n",
+	})
+
+	p := New(dirfs.New(t.TempDir()), Options{Compression: CompressionOptions{GzipLevel: -1}})
+	err := p.Parse(sourceFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := p.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manualPath := "campaigns/generic/faq/nl-NL/index.html"
+
+	html, err := fs.ReadFile(current, manualPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := fs.ReadFile(current, manualPath+".br")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decompressed, err := io.ReadAll(brotli.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decompressed, html) {
+		t.Errorf("expected the .br file to contain the manual")
+	}
+
+	if _, err := fs.Stat(current, manualPath+".gz"); err == nil {
+		t.Errorf("expected no .gz file when gzip is disabled")
+	}
+
+	manifest, err := ReadManifest(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := manifest[manualPath+".br"]; !ok {
+		t.Errorf("expected the .br file in the manifest")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("<p>Steek de kabel in de P1-poort.</p>\n"), 20)
+
+	compressed, err := compress(data, EncodingGzip, DefaultGzipLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decompressed, data) || len(compressed) >= len(data) {
+		t.Errorf("expected smaller gzip data that decompresses to the original")
+	}
+
+	if err := (CompressionOptions{BrotliLevel: 12}).Validate(); err == nil {
+		t.Errorf("expected brotli level 12 to be invalid")
+	}
+}
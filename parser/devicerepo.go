@@ -2,8 +2,8 @@ package parser
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
-	"log"
 	"os"
 	"path"
 	"strings"
@@ -13,23 +13,23 @@ import (
 
 // DeviceRepoSource is a git repo that contains manuals made by developers of a device.
 type DeviceRepoSource struct {
-	fs.FS
-	repoName string
+	*gitRepo
 }
 
-// Create a new source filesystem from a directory at path.
-func NewDeviceRepoSource(url string, auth transport.AuthMethod) (fs.FS, error) {
-	gitFS, repoName, err := newGitFSWithAuth(url, "", auth)
+// Create a new source filesystem from a git repo at url.
+//
+// The default branch is cloned, unless ref is set.
+// ref can be a tag or a commit hash to pin the source to a specific revision.
+func NewDeviceRepoSource(url string, ref string, auth transport.AuthMethod) (fs.FS, error) {
+	repo, err := newGitFSWithAuth(url, "", ref, auth)
+	if errors.Is(err, transport.ErrAuthenticationRequired) {
+		return nil, fmt.Errorf("%w: configure credentials for %s to use its manuals", err, RedactURL(url))
+	}
 	if err != nil {
-		if errors.Is(err, transport.ErrAuthenticationRequired) {
-			log.Println("device repo for", url, "could not be opened because it needs authentication")
-			return nil, nil
-		}
-
 		return nil, err
 	}
 
-	return DeviceRepoSource{gitFS, repoName}, nil
+	return DeviceRepoSource{repo}, nil
 }
 
 // Get the path to copy a file to at the destination filesystem.
@@ -51,7 +51,7 @@ func (repo DeviceRepoSource) GetDestinationFilePath(filePath string) string {
 	// Replace docs/manuals with devices/{deviceName}.
 	// Device name is the same as repo name.
 	splitDirPath[0] = "devices"
-	splitDirPath[1] = repo.repoName
+	splitDirPath[1] = repo.name
 
 	// Add "manuafacturer" to the dir path as 'campaign', just before the last element.
 	subDir := splitDirPath[len(splitDirPath)-1]
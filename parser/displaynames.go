@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	displayNamesFileName = "display_names.json"
+
+	// Separates the display name and the manual type in a title.
+	titleSeparator = " – "
+)
+
+var (
+	ErrDisplayNamesEmpty = errors.New("there are no display names")
+	ErrDisplayNameEmpty  = errors.New("display name is empty")
+
+	ErrDisplayNameLanguageNotCanonical = errors.New("language code is not canonical")
+)
+
+// Categories of manuals that have display names for each entity.
+var displayNameCategories = map[string]bool{
+	"devices":        true,
+	"energy_queries": true,
+	"cloud_feeds":    true,
+}
+
+// Read a display_names.json file at filePath.
+// The display names are returned by language code.
+func readDisplayNames(fsys fs.FS, filePath string) (map[string]string, error) {
+	data, err := fs.ReadFile(fsys, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDisplayNamesFile(data)
+}
+
+// Parse the contents of a display_names.json file, which must be a JSON object
+// with a non-empty display name for at least one valid language code.
+// Language codes have to be in their canonical form (e.g. 'nl-NL' instead of 'nl-nl'),
+// because the server looks up display names by the canonical language code.
+func parseDisplayNamesFile(data []byte) (map[string]string, error) {
+	var displayNames map[string]string
+	err := json.Unmarshal(data, &displayNames)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(displayNames) == 0 {
+		return nil, ErrDisplayNamesEmpty
+	}
+
+	for _, lang := range sortedKeys(displayNames) {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", lang, err)
+		}
+
+		if tag.String() != lang {
+			return nil, fmt.Errorf("%w: %q should be written as %q", ErrDisplayNameLanguageNotCanonical, lang, tag.String())
+		}
+
+		if strings.TrimSpace(displayNames[lang]) == "" {
+			return nil, fmt.Errorf("%s: %w", lang, ErrDisplayNameEmpty)
+		}
+	}
+
+	return displayNames, nil
+}
+
+// Create a title for the manual at destFilePath in lang, using the display name of its device,
+// energy query or cloud feed (e.g. 'Smart meter module – installation').
+//
+// The display names are read from labFS, because manuals from a device repository
+// do not contain display names themselves.
+// Returns false if there is no display name for the manual.
+func displayNameTitle(labFS fs.FS, destFilePath string, lang string) (string, bool) {
+	// e.g. devices/<device>/<manual_type>/<campaign>/languages/<lang>.md
+	splitPath := strings.Split(destFilePath, "/")
+	if len(splitPath) < 4 || !displayNameCategories[splitPath[0]] || labFS == nil {
+		return "", false
+	}
+
+	displayNames, err := readDisplayNames(labFS, path.Join(splitPath[0], splitPath[1], displayNamesFileName))
+	if err != nil {
+		return "", false
+	}
+
+	displayName, ok := matchDisplayName(displayNames, lang)
+	if !ok {
+		return "", false
+	}
+
+	manualType := strings.NewReplacer("_", " ", "-", " ").Replace(splitPath[2])
+
+	return displayName + titleSeparator + manualType, true
+}
+
+// Return the display name in displayNames that best matches lang.
+// Returns false if no display name matches.
+func matchDisplayName(displayNames map[string]string, lang string) (string, bool) {
+	if displayName, ok := displayNames[lang]; ok {
+		return displayName, true
+	}
+
+	var (
+		tags  []language.Tag
+		names []string
+	)
+	for code, displayName := range displayNames {
+		tag, err := language.Parse(code)
+		if err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+		names = append(names, displayName)
+	}
+
+	if len(tags) == 0 {
+		return "", false
+	}
+
+	_, index, confidence := language.NewMatcher(tags).Match(language.Make(lang))
+	if confidence == language.No {
+		return "", false
+	}
+
+	return names[index], true
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDisplayNameTitle(t *testing.T) {
+	labFS := fstest.MapFS{
+		"devices/smart-meter/display_names.json":   {Data: []byte(`{"nl-NL": "Slimme meter module", "en-US": "Smart meter module"}`)},
+		"cloud_feeds/enelogic/display_names.json":  {Data: []byte(`{"en-US": "Enelogic"}`)},
+		"energy_queries/broken/display_names.json": {Data: []byte(`{"en-US": `)},
+	}
+
+	testDisplayNameTitle(t, labFS, "devices/smart-meter/installation/generic/languages/nl-NL.md", "nl-NL", "Slimme meter module – installation", true)
+	testDisplayNameTitle(t, labFS, "devices/smart-meter/installation/generic/languages/en-GB.md", "en-GB", "Smart meter module – installation", true)
+	testDisplayNameTitle(t, labFS, "cloud_feeds/enelogic/privacy_policy/generic/languages/en-US.md", "en-US", "Enelogic – privacy policy", true)
+	testDisplayNameTitle(t, labFS, "cloud_feeds/enelogic/faq/generic/languages/nl-NL.md", "nl-NL", "", false)
+	testDisplayNameTitle(t, labFS, "energy_queries/broken/faq/generic/languages/en-US.md", "en-US", "", false)
+	testDisplayNameTitle(t, labFS, "devices/unknown/faq/generic/languages/en-US.md", "en-US", "", false)
+	testDisplayNameTitle(t, labFS, "campaigns/generic/faq/languages/en-US.md", "en-US", "", false)
+}
+
+func testDisplayNameTitle(t *testing.T, labFS fstest.MapFS, destFilePath string, lang string, expectedTitle string, expectedOK bool) {
+	t.Run(destFilePath, func(t *testing.T) {
+		title, ok := displayNameTitle(labFS, destFilePath, lang)
+		if ok != expectedOK {
+			t.Fatalf("expected ok %t, got %t", expectedOK, ok)
+		}
+
+		if title != expectedTitle {
+			t.Fatalf("expected title %q, got %q", expectedTitle, title)
+		}
+	})
+}
+
+func TestParseDisplayNamesFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"valid", `{"nl-NL": "Slimme meter", "en-US": "Smart meter"}`, nil},
+		{"empty", `{}`, ErrDisplayNamesEmpty},
+		{"null", `null`, ErrDisplayNamesEmpty},
+		{"empty display name", `{"nl-NL": " "}`, ErrDisplayNameEmpty},
+		{"lowercase region", `{"nl-nl": "Slimme meter"}`, ErrDisplayNameLanguageNotCanonical},
+		{"underscore", `{"en_US": "Smart meter"}`, ErrDisplayNameLanguageNotCanonical},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseDisplayNamesFile([]byte(test.data))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+		})
+	}
+
+	for _, data := range []string{`["Smart meter"]`, `{"nl-NL": 1}`, `{"not a language": "Smart meter"}`} {
+		_, err := parseDisplayNamesFile([]byte(data))
+		if err == nil {
+			t.Errorf("expected an error for %s", data)
+		}
+	}
+}
+
+func TestParseDisplayNamesFileCanonicalForm(t *testing.T) {
+	_, err := parseDisplayNamesFile([]byte(`{"nl-nl": "Slimme meter"}`))
+	if err == nil || !strings.Contains(err.Error(), `"nl-NL"`) {
+		t.Fatalf("expected the error to show the canonical language code, got %v", err)
+	}
+}
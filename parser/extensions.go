@@ -0,0 +1,437 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// Extension is custom markdown syntax that can be enabled for a manual source.
+//
+// Every extension is a block that starts with a '::: name' line and ends with a ':::' line.
+// Blocks can be nested.
+type Extension string
+
+const (
+	// Callouts for notes, tips and warnings:
+	//
+	//	::: warning Disconnect the power first
+	//	Content of the warning.
+	//	:::
+	ExtensionAdmonitions Extension = "admonitions"
+
+	// Numbered installation steps. Every heading in the block starts a new step:
+	//
+	//	::: steps
+	//	### Mount the meter
+	//	![Meter](../assets/meter.png)
+	//	:::
+	ExtensionSteps Extension = "steps"
+
+	// Tabs, for example for instructions per platform:
+	//
+	//	::: tabs
+	//	::: tab Android
+	//	Instructions for Android.
+	//	:::
+	//	::: tab iOS
+	//	Instructions for iOS.
+	//	:::
+	//	:::
+	ExtensionTabs Extension = "tabs"
+)
+
+const (
+	// Name of the file that sets the extensions of a manual source.
+	// It is in the root of a lab's source, or in docs/manuals in a device firmware repository.
+	MarkdownConfigFileName = "markdown.json"
+)
+
+var (
+	ErrExtensionUnknown = errors.New("unknown markdown extension")
+)
+
+// Paths a markdown config file is looked for in a manual source.
+var markdownConfigPaths = []string{MarkdownConfigFileName, "docs/manuals/" + MarkdownConfigFileName}
+
+// Kinds of admonitions.
+var admonitionKinds = map[string]bool{
+	"note":    true,
+	"tip":     true,
+	"warning": true,
+}
+
+var (
+	// Matches the first line of an extension block (e.g. '::: warning Title').
+	blockOpeningRegExp = regexp.MustCompile(`^:{3,}[ \t]*([A-Za-z][\w-]*)[ \t]*(.*?)[ \t]*$`)
+	// Matches the last line of an extension block.
+	blockClosingRegExp = regexp.MustCompile(`^:{3,}[ \t]*$`)
+	// Matches the start or end of a fenced code block.
+	codeFenceRegExp = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// Contents of a markdown config file.
+type markdownConfig struct {
+	Extensions []Extension `json:"extensions"`
+}
+
+// An admonition is a callout, such as a warning.
+type admonition struct {
+	ast.Container
+
+	Kind  string
+	Title string
+}
+
+// A list of installation steps.
+type steps struct {
+	ast.Container
+}
+
+// A single installation step.
+type step struct {
+	ast.Container
+}
+
+// A set of tabs, of which one is shown at a time.
+type tabs struct {
+	ast.Container
+}
+
+// A single tab in a set of tabs.
+type tab struct {
+	ast.Container
+
+	Title string
+}
+
+// Parse a comma separated list of extensions. Returns nil if s is empty.
+func ParseExtensions(s string) ([]Extension, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var extensions []Extension
+	for _, name := range strings.Split(s, ",") {
+		extension := Extension(strings.TrimSpace(name))
+
+		err := extension.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		extensions = append(extensions, extension)
+	}
+
+	return extensions, nil
+}
+
+// Returns an error if e is not a known extension.
+func (e Extension) validate() error {
+	switch e {
+	case ExtensionAdmonitions, ExtensionSteps, ExtensionTabs:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrExtensionUnknown, e)
+}
+
+// Read the extensions set by the markdown config file in sourceFS.
+// The path of the file is returned too, or an empty string if sourceFS does not contain one.
+func readExtensions(sourceFS fs.FS) ([]Extension, string, error) {
+	for _, filePath := range markdownConfigPaths {
+		data, err := fs.ReadFile(sourceFS, filePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, filePath, err
+		}
+
+		extensions, err := parseMarkdownConfig(data)
+		return extensions, filePath, err
+	}
+
+	return nil, "", nil
+}
+
+// Parse the contents of a markdown config file.
+func parseMarkdownConfig(data []byte) ([]Extension, error) {
+	var config markdownConfig
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, extension := range config.Extensions {
+		err = extension.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config.Extensions, nil
+}
+
+// Parse md to an AST with the common extensions and the custom extensions in extensions.
+// Table of contents markers are replaced with a placeholder.
+func parseMarkdown(md []byte, extensions []Extension) ast.Node {
+	mdParser := parser.NewWithExtensions(parser.CommonExtensions)
+
+	enabled := map[Extension]bool{}
+	for _, extension := range extensions {
+		enabled[extension] = true
+	}
+
+	if len(enabled) > 0 {
+		mdParser.Opts.ParserHook = func(data []byte) (ast.Node, []byte, int) {
+			return parseExtensionBlock(data, enabled)
+		}
+	}
+
+	doc := mdParser.Parse(md)
+
+	if enabled[ExtensionSteps] {
+		groupSteps(doc)
+	}
+
+	replaceTOCMarkers(doc)
+
+	return doc
+}
+
+// Render doc to HTML, including the nodes of custom extensions.
+// toc is rendered in place of the table of contents markers.
+func renderMarkdown(doc ast.Node, toc TableOfContents) []byte {
+	r := &extensionRenderer{toc: toc}
+
+	htmlRenderer := html.NewRenderer(html.RendererOptions{
+		Flags:          html.CommonFlags,
+		RenderNodeHook: r.renderNode,
+	})
+
+	return markdown.Render(doc, htmlRenderer)
+}
+
+// Parse an extension block at the start of data.
+//
+// Returns the node of the block, the markdown inside it and the number of bytes of data it consumed.
+// Nothing is consumed if data does not start with a block of an extension in enabled.
+func parseExtensionBlock(data []byte, enabled map[Extension]bool) (ast.Node, []byte, int) {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	match := blockOpeningRegExp.FindSubmatch(firstLine)
+	if match == nil {
+		return nil, nil, 0
+	}
+
+	name, title := string(match[1]), string(match[2])
+
+	var node ast.Node
+	switch {
+	case enabled[ExtensionAdmonitions] && admonitionKinds[name]:
+		node = &admonition{Kind: name, Title: title}
+	case enabled[ExtensionSteps] && name == "steps":
+		node = &steps{}
+	case enabled[ExtensionTabs] && name == "tabs":
+		node = &tabs{}
+	case enabled[ExtensionTabs] && name == "tab":
+		node = &tab{Title: title}
+	default:
+		return nil, nil, 0
+	}
+
+	contentStart := len(firstLine) + 1
+	if contentStart > len(data) {
+		return nil, nil, 0
+	}
+
+	contentEnd, consumed := findBlockEnd(data, contentStart)
+	if consumed == 0 {
+		return nil, nil, 0
+	}
+
+	return node, data[contentStart:contentEnd], consumed
+}
+
+// Find the ':::' line that closes the block with content starting at start in data.
+// Nested blocks and fenced code blocks are skipped.
+//
+// Returns where the content ends and where the closing line ends,
+// or 0 if the block is not closed.
+func findBlockEnd(data []byte, start int) (int, int) {
+	depth := 1
+	var fence string
+
+	for lineStart := start; lineStart < len(data); {
+		lineEnd := bytes.IndexByte(data[lineStart:], '\n')
+		next := lineStart + lineEnd + 1
+		if lineEnd < 0 {
+			lineEnd = len(data) - lineStart
+			next = len(data)
+		}
+		line := data[lineStart : lineStart+lineEnd]
+
+		if match := codeFenceRegExp.FindSubmatch(line); match != nil {
+			if fence == "" {
+				fence = string(match[1])
+			} else if fence == string(match[1]) {
+				fence = ""
+			}
+		} else if fence == "" {
+			if blockClosingRegExp.Match(line) {
+				depth--
+				if depth == 0 {
+					return lineStart, next
+				}
+			} else if blockOpeningRegExp.Match(line) {
+				depth++
+			}
+		}
+
+		lineStart = next
+	}
+
+	return 0, 0
+}
+
+// Put the children of every steps node in doc in a step for every heading.
+// Content before the first heading is put in a step without a title.
+func groupSteps(doc ast.Node) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		stepsNode, ok := node.(*steps)
+		if !entering || !ok {
+			return ast.GoToNext
+		}
+
+		var current *step
+		children := stepsNode.Children
+		stepsNode.Children = nil
+
+		for _, child := range children {
+			heading, isHeading := child.(*ast.Heading)
+			if current == nil || isHeading {
+				current = &step{}
+				current.Parent = stepsNode
+				stepsNode.Children = append(stepsNode.Children, current)
+			}
+
+			if isHeading {
+				if heading.Attribute == nil {
+					heading.Attribute = &ast.Attribute{}
+				}
+				heading.Attribute.Classes = append(heading.Attribute.Classes, []byte("step-title"))
+			}
+
+			// ast.AppendChild would remove the children of child.
+			child.SetParent(current)
+			current.Children = append(current.Children, child)
+		}
+
+		return ast.GoToNext
+	})
+}
+
+// An extensionRenderer renders the nodes of custom extensions to HTML
+// with stable CSS classes, which are styled by the default templates.
+type extensionRenderer struct {
+	toc TableOfContents
+
+	// Number of sets of tabs rendered so far, to give every set unique IDs.
+	tabSets int
+}
+
+// Render node if it is a node of a custom extension. Implements html.RenderNodeFunc.
+func (r *extensionRenderer) renderNode(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch node := node.(type) {
+	case *tocPlaceholder:
+		io.WriteString(w, string(r.toc.HTML()))
+	case *admonition:
+		if entering {
+			io.WriteString(w, "<div class=\"admonition admonition-"+node.Kind+"\">\n")
+			if node.Title != "" {
+				io.WriteString(w, "<p class=\"admonition-title\">")
+				html.EscapeHTML(w, []byte(node.Title))
+				io.WriteString(w, "</p>\n")
+			}
+		} else {
+			io.WriteString(w, "</div>\n")
+		}
+	case *steps:
+		if entering {
+			io.WriteString(w, "<ol class=\"steps\">\n")
+		} else {
+			io.WriteString(w, "</ol>\n")
+		}
+	case *step:
+		if entering {
+			io.WriteString(w, "<li class=\"step\">\n")
+		} else {
+			io.WriteString(w, "</li>\n")
+		}
+	case *tabs:
+		if entering {
+			r.tabSets++
+			io.WriteString(w, "<div class=\"tabs\">\n")
+		} else {
+			io.WriteString(w, "</div>\n")
+		}
+	case *tab:
+		if !entering {
+			io.WriteString(w, "</div>\n")
+			break
+		}
+
+		if _, ok := node.Parent.(*tabs); !ok {
+			io.WriteString(w, "<div class=\"tab-panel\">\n")
+			break
+		}
+
+		group := "tabs-" + strconv.Itoa(r.tabSets)
+		index := tabIndex(node)
+		id := group + "-" + strconv.Itoa(index+1)
+
+		checked := ""
+		if index == 0 {
+			checked = " checked"
+		}
+
+		io.WriteString(w, "<input type=\"radio\" class=\"tab-input\" name=\""+group+"\" id=\""+id+"\""+checked+">\n")
+		io.WriteString(w, "<label class=\"tab-label\" for=\""+id+"\">")
+		html.EscapeHTML(w, []byte(node.Title))
+		io.WriteString(w, "</label>\n")
+		io.WriteString(w, "<div class=\"tab-panel\">\n")
+	default:
+		return ast.GoToNext, false
+	}
+
+	return ast.GoToNext, true
+}
+
+// Return the index of node among the tabs in its set of tabs.
+func tabIndex(node *tab) int {
+	index := 0
+	for _, sibling := range node.Parent.GetChildren() {
+		if sibling == node {
+			break
+		}
+		if _, ok := sibling.(*tab); ok {
+			index++
+		}
+	}
+
+	return index
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRenderExtensions(t *testing.T) {
+	all := []Extension{ExtensionAdmonitions, ExtensionSteps, ExtensionTabs}
+
+	testRenderExtensions(t, "admonition", all,
+		"::: warning Disconnect <power>\nDo **not** open the meter.\n:::\n",
+		"<div class=\"admonition admonition-warning\">\n<p class=\"admonition-title\">Disconnect &lt;power&gt;</p>\n<p>Do <strong>not</strong> open the meter.</p>\n</div>\n")
+
+	testRenderExtensions(t, "disabled", nil,
+		"::: note\nText\n:::\n",
+		"<p>::: note\nText\n:::</p>\n")
+
+	testRenderExtensions(t, "unclosed", all,
+		"::: note\nText\n",
+		"<p>::: note\nText</p>\n")
+
+	testRenderExtensions(t, "code fence", all,
+		"::: tip\n```\n:::\n```\n:::\n",
+		"<div class=\"admonition admonition-tip\">\n<pre><code>:::\n</code></pre>\n</div>\n")
+
+	testRenderExtensions(t, "steps", all,
+		"::: steps\nBefore you start.\n\n### Mount\n![Meter](meter.png)\n\n### Connect\nPlug it in.\n:::\n",
+		"<ol class=\"steps\">\n<li class=\"step\">\n<p>Before you start.</p>\n</li>\n"+
+			"<li class=\"step\">\n\n<h3 class=\"step-title\">Mount</h3>\n\n<p><img src=\"meter.png\" alt=\"Meter\" /></p>\n</li>\n"+
+			"<li class=\"step\">\n\n<h3 class=\"step-title\">Connect</h3>\n\n<p>Plug it in.</p>\n</li>\n</ol>\n")
+
+	testRenderExtensions(t, "tabs", all,
+		"::: tabs\n::: tab Android\nOpen the app.\n:::\n::: tab iOS\n::: note\nNested.\n:::\n:::\n:::\n",
+		"<div class=\"tabs\">\n"+
+			"<input type=\"radio\" class=\"tab-input\" name=\"tabs-1\" id=\"tabs-1-1\" checked>\n<label class=\"tab-label\" for=\"tabs-1-1\">Android</label>\n<div class=\"tab-panel\">\n<p>Open the app.</p>\n</div>\n"+
+			"<input type=\"radio\" class=\"tab-input\" name=\"tabs-1\" id=\"tabs-1-2\">\n<label class=\"tab-label\" for=\"tabs-1-2\">iOS</label>\n<div class=\"tab-panel\">\n"+
+			"<div class=\"admonition admonition-note\">\n<p>Nested.</p>\n</div>\n</div>\n</div>\n")
+}
+
+func testRenderExtensions(t *testing.T, name string, extensions []Extension, md string, expected string) {
+	t.Run(name, func(t *testing.T) {
+		rendered := string(renderMarkdown(parseMarkdown([]byte(md), extensions), nil))
+		if rendered != expected {
+			t.Fatalf("expected:\n%s\ngot:\n%s", expected, rendered)
+		}
+	})
+}
+
+func TestParseMarkdownConfig(t *testing.T) {
+	extensions, err := parseMarkdownConfig([]byte(`{"extensions": ["admonitions", "tabs"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(extensions) != 2 || extensions[0] != ExtensionAdmonitions || extensions[1] != ExtensionTabs {
+		t.Fatalf("unexpected extensions %v", extensions)
+	}
+
+	_, err = parseMarkdownConfig([]byte(`{"extensions": ["mermaid"]}`))
+	if !errors.Is(err, ErrExtensionUnknown) {
+		t.Fatalf("expected %v, got %v", ErrExtensionUnknown, err)
+	}
+
+	_, err = ParseExtensions("steps, tables")
+	if err == nil || !strings.Contains(err.Error(), "tables") {
+		t.Fatalf("expected unknown extension error, got %v", err)
+	}
+}
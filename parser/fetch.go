@@ -0,0 +1,317 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+)
+
+const (
+	// Directory in the destination filesystem where remote images are cached.
+	remoteCacheDir = "remote_cache"
+
+	remoteCacheMetaFileName = "meta.json"
+	remoteCacheDataFileName = "data"
+
+	defaultFetchTimeout = 10 * time.Second
+	defaultFetchMaxSize = 10 << 20
+)
+
+var (
+	ErrRemoteHostNotAllowed = errors.New("host is not allowed")
+	ErrRemoteTooLarge       = errors.New("remote file is too large")
+	ErrRemoteNotImage       = errors.New("remote file is not an image")
+
+	// Returned for remote SVG images, which can contain scripts that would run on the origin of the server.
+	ErrRemoteSVG = errors.New("remote SVG images are not allowed")
+
+	// Returned when a remote image is not downloaded, because the parser is offline.
+	// The image keeps its original URL.
+	errRemoteOffline = errors.New("offline")
+)
+
+// FetchOptions for downloading remote images in manuals.
+type FetchOptions struct {
+	// Timeout for downloading a single image. Defaults to 10 seconds.
+	Timeout time.Duration
+
+	// Maximum size of an image in bytes. Defaults to 10 MiB.
+	MaxSize int64
+
+	// Hosts images can be downloaded from. Subdomains of a host are allowed too.
+	// All hosts are allowed when it is empty.
+	AllowedHosts []string
+
+	// Offline makes the parser use cached images only. Images that are not cached keep their original URL.
+	Offline bool
+}
+
+// Metadata of a cached remote image.
+type remoteCacheMeta struct {
+	URL         string `json:"url"`
+	ETag        string `json:"etag,omitempty"`
+	ContentType string `json:"content_type"`
+}
+
+// A remoteFetcher downloads remote images and caches them in a filesystem.
+type remoteFetcher struct {
+	options FetchOptions
+	client  *http.Client
+	cacheFS fs.FS
+
+	// Keys of cache entries used by the parse that is running.
+	used map[string]bool
+}
+
+// Create a remoteFetcher that caches images in cacheFS, which has to be writable.
+func newRemoteFetcher(cacheFS fs.FS, options FetchOptions) *remoteFetcher {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultFetchTimeout
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = defaultFetchMaxSize
+	}
+
+	f := &remoteFetcher{
+		options: options,
+		cacheFS: cacheFS,
+	}
+
+	f.client = &http.Client{
+		Timeout: options.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return f.checkHost(req.URL)
+		},
+	}
+
+	return f
+}
+
+// Return if source is the URL of a remote file.
+func isRemote(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Download the image at rawURL.
+//
+// A cached image is used if the server responds that it was not modified, or if it cannot be downloaded.
+// errRemoteOffline is returned when offline and the image is not cached.
+func (f *remoteFetcher) fetch(rawURL string) ([]byte, error) {
+	imageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.checkHost(imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cacheKey(rawURL)
+	if f.used != nil {
+		f.used[key] = true
+	}
+
+	cacheDir := path.Join(remoteCacheDir, key)
+	meta, cached := f.readCache(cacheDir)
+
+	if f.options.Offline {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, errRemoteOffline
+	}
+
+	data, err := f.download(rawURL, cacheDir, meta, cached)
+	if err != nil && cached != nil {
+		log.Println("using cached image, because", rawURL, "could not be downloaded:", err)
+		return cached, nil
+	}
+
+	return data, err
+}
+
+// Download the image at rawURL and write it to the cache in cacheDir.
+// When meta has an ETag, cached is returned if the image was not modified.
+func (f *remoteFetcher) download(rawURL string, cacheDir string, meta remoteCacheMeta, cached []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil && meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if resp.ContentLength > f.options.MaxSize {
+		return nil, fmt.Errorf("%w: %d bytes, the maximum is %d bytes", ErrRemoteTooLarge, resp.ContentLength, f.options.MaxSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.options.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > f.options.MaxSize {
+		return nil, fmt.Errorf("%w: the maximum is %d bytes", ErrRemoteTooLarge, f.options.MaxSize)
+	}
+
+	contentType := sniffImageType(data, rawURL)
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteNotImage, contentType)
+	}
+	if contentType == "image/svg+xml" {
+		return nil, ErrRemoteSVG
+	}
+
+	meta = remoteCacheMeta{
+		URL:         rawURL,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: contentType,
+	}
+
+	err = f.writeCache(cacheDir, meta, data)
+	if err != nil {
+		log.Println("error caching image", rawURL+":", err)
+	}
+
+	return data, nil
+}
+
+// Returns an error if images cannot be downloaded from the host of imageURL.
+func (f *remoteFetcher) checkHost(imageURL *url.URL) error {
+	if len(f.options.AllowedHosts) == 0 {
+		return nil
+	}
+
+	host := strings.ToLower(imageURL.Hostname())
+	for _, allowed := range f.options.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrRemoteHostNotAllowed, host)
+}
+
+// Read the cached image in cacheDir. The data is nil if it is not cached.
+func (f *remoteFetcher) readCache(cacheDir string) (remoteCacheMeta, []byte) {
+	var meta remoteCacheMeta
+
+	metaData, err := fs.ReadFile(f.cacheFS, path.Join(cacheDir, remoteCacheMetaFileName))
+	if err != nil || json.Unmarshal(metaData, &meta) != nil {
+		return meta, nil
+	}
+
+	// SVG images that were cached before they were rejected are not used.
+	if meta.ContentType == "image/svg+xml" {
+		return meta, nil
+	}
+
+	data, err := fs.ReadFile(f.cacheFS, path.Join(cacheDir, remoteCacheDataFileName))
+	if err != nil {
+		return meta, nil
+	}
+
+	return meta, data
+}
+
+// Write the image with data and meta to the cache in cacheDir.
+func (f *remoteFetcher) writeCache(cacheDir string, meta remoteCacheMeta, data []byte) error {
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	err = wfs.MkdirAll(f.cacheFS, cacheDir, fs.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = wfs.WriteFile(f.cacheFS, path.Join(cacheDir, remoteCacheDataFileName), data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return wfs.WriteFile(f.cacheFS, path.Join(cacheDir, remoteCacheMetaFileName), metaData, 0644)
+}
+
+// Remove cached images that were not used by the last parse.
+func (f *remoteFetcher) pruneCache() error {
+	entries, err := fs.ReadDir(f.cacheFS, remoteCacheDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if f.used[entry.Name()] {
+			continue
+		}
+
+		err = wfs.RemoveAll(f.cacheFS, path.Join(remoteCacheDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return the key of the cache entry for rawURL.
+func cacheKey(rawURL string) string {
+	hash := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(hash[:])
+}
+
+// Return the media type of image data from its contents.
+// name is only used to recognise SVG images, which cannot be recognised from their contents.
+func sniffImageType(data []byte, name string) string {
+	contentType := http.DetectContentType(data)
+
+	if strings.HasPrefix(contentType, "text/") {
+		if sourceURL, err := url.Parse(name); err == nil {
+			name = sourceURL.Path
+		}
+
+		if strings.EqualFold(path.Ext(name), ".svg") || strings.Contains(string(data), "<svg") {
+			return "image/svg+xml"
+		}
+	}
+
+	// Remove parameters, such as charset.
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return mediaType
+}
@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// Start a server that serves testPNG with an ETag at /image.png, text at /text and an SVG image at /logo.svg.
+// requests counts the requests for /image.png that were not answered with 304 Not Modified.
+func newTestImageServer(t *testing.T, requests *int) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		*requests++
+		w.Write(testPNG)
+	})
+
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not an image"))
+	})
+
+	mux.HandleFunc("/logo.svg", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestRemoteFetcher(t *testing.T) {
+	var requests int
+	server := newTestImageServer(t, &requests)
+	cacheFS := dirfs.New(t.TempDir())
+
+	f := newRemoteFetcher(cacheFS, FetchOptions{})
+
+	for i := 0; i < 2; i++ {
+		data, err := f.fetch(server.URL + "/image.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, testPNG) {
+			t.Fatalf("expected the image, got %q", data)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("expected the image to be downloaded once and then validated using its ETag, got %d downloads", requests)
+	}
+
+	_, err := f.fetch(server.URL + "/text")
+	if !errors.Is(err, ErrRemoteNotImage) {
+		t.Errorf("expected %v, got %v", ErrRemoteNotImage, err)
+	}
+
+	_, err = f.fetch(server.URL + "/logo.svg")
+	if !errors.Is(err, ErrRemoteSVG) {
+		t.Errorf("expected %v, got %v", ErrRemoteSVG, err)
+	}
+
+	offline := newRemoteFetcher(cacheFS, FetchOptions{Offline: true})
+
+	_, err = offline.fetch(server.URL + "/image.png")
+	if err != nil {
+		t.Errorf("expected the cached image to be used offline, got %v", err)
+	}
+
+	_, err = offline.fetch(server.URL + "/other.png")
+	if !errors.Is(err, errRemoteOffline) {
+		t.Errorf("expected %v, got %v", errRemoteOffline, err)
+	}
+}
+
+func TestRemoteFetcherLimits(t *testing.T) {
+	var requests int
+	server := newTestImageServer(t, &requests)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooSmall := newRemoteFetcher(dirfs.New(t.TempDir()), FetchOptions{MaxSize: 4})
+
+	_, err = tooSmall.fetch(server.URL + "/image.png")
+	if !errors.Is(err, ErrRemoteTooLarge) {
+		t.Errorf("expected %v, got %v", ErrRemoteTooLarge, err)
+	}
+
+	otherHost := newRemoteFetcher(dirfs.New(t.TempDir()), FetchOptions{AllowedHosts: []string{"example.com"}})
+
+	_, err = otherHost.fetch(server.URL + "/image.png")
+	if !errors.Is(err, ErrRemoteHostNotAllowed) {
+		t.Errorf("expected %v, got %v", ErrRemoteHostNotAllowed, err)
+	}
+
+	sameHost := newRemoteFetcher(dirfs.New(t.TempDir()), FetchOptions{AllowedHosts: []string{serverURL.Hostname()}})
+
+	_, err = sameHost.fetch(server.URL + "/image.png")
+	if err != nil {
+		t.Errorf("expected the image to be downloaded, got %v", err)
+	}
+}
+
+func TestSniffImageType(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		name     string
+		expected string
+	}{
+		{testPNG, "https://example.com/image", "image/png"},
+		{testPNG, "https://example.com/image.jpg", "image/png"},
+		{[]byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "https://example.com/logo", "image/svg+xml"},
+		{[]byte("text"), "https://example.com/image.png", "text/plain"},
+	}
+
+	for _, test := range tests {
+		contentType := sniffImageType(test.data, test.name)
+		if contentType != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, contentType)
+		}
+	}
+}
+
+func TestParseRemoteImageFailure(t *testing.T) {
+	var requests int
+	server := newTestImageServer(t, &requests)
+
+	images := []string{
+		server.URL + "/text",
+		server.URL + "/logo.svg",
+		server.URL + "/missing.png",
+		"http://example.com/image.png",
+	}
+
+	manual := "# FAQ\n\n"
+	for _, image := range images {
+		manual += "![image](" + image + ")\n\n"
+	}
+
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/en-US.md": manual,
+	})
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []ImageMode{ImageModeFiles, ImageModeInline} {
+		t.Run(string(mode), func(t *testing.T) {
+			p := New(dirfs.New(t.TempDir()), Options{
+				ImageMode: mode,
+				Remote:    FetchOptions{AllowedHosts: []string{serverURL.Hostname()}},
+			})
+
+			err := p.Parse(sourceFS)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			current, err := p.Current()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := fs.ReadFile(current, "campaigns/generic/faq/en-US/index.html")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, image := range images {
+				if !strings.Contains(string(data), `src="`+image+`"`) {
+					t.Errorf("expected the manual to keep the URL of %s", image)
+				}
+			}
+
+			warnings := p.Report().Warnings
+			if len(warnings) != len(images) || warnings[0].Stage != StageImages || !errors.Is(warnings[0], ErrRemoteNotImage) {
+				t.Errorf("expected a warning for every image, got %v", warnings)
+			}
+		})
+	}
+}
+
+func TestParsePrunesRemoteCache(t *testing.T) {
+	var requests int
+	server := newTestImageServer(t, &requests)
+
+	destFS := dirfs.New(t.TempDir())
+	p := New(destFS, Options{})
+
+	withImage := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/en-US.md": "# FAQ\n\n![image](" + server.URL + "/image.png)\n",
+	})
+
+	err := p.Parse(withImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := fs.ReadDir(destFS, remoteCacheDir)
+	if err != nil || len(entries) != 1 || entries[0].Name() != cacheKey(server.URL+"/image.png") {
+		t.Fatalf("expected the image to be cached, got %v, %v", entries, err)
+	}
+
+	withoutImage := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/en-US.md": "# FAQ\n",
+	})
+
+	err = p.Parse(withoutImage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = fs.ReadDir(destFS, remoteCacheDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected the unused image to be removed from the cache, got %v, %v", entries, err)
+	}
+}
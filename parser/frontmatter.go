@@ -0,0 +1,207 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	yamlFrontMatterDelimiter = "---"
+	tomlFrontMatterDelimiter = "+++"
+
+	// Layout of dates in front matter.
+	frontMatterDateLayout = "2006-01-02"
+)
+
+var (
+	ErrFrontMatterInvalid = errors.New("front matter is invalid")
+)
+
+// FrontMatter contains metadata about a manual.
+//
+// It is set in a YAML block (between '---' lines) or TOML block (between '+++' lines)
+// at the start of a markdown file.
+type FrontMatter struct {
+	Title        string
+	Description  string
+	LastReviewed time.Time
+	Author       string
+	Version      string
+	Keywords     []string
+
+	// All fields that are not known, by name.
+	Extra map[string]any
+}
+
+// Split the front matter from a markdown file and parse it.
+//
+// input is the bytes read from a markdown file.
+// The markdown without the front matter block is returned.
+// If there is no front matter, an empty FrontMatter and the unchanged input are returned.
+func parseFrontMatter(input []byte) (FrontMatter, []byte, error) {
+	block, body, delimiter := splitFrontMatter(input)
+	if delimiter == "" {
+		return FrontMatter{}, input, nil
+	}
+
+	fields := map[string]any{}
+
+	var err error
+	switch delimiter {
+	case yamlFrontMatterDelimiter:
+		err = yaml.Unmarshal(block, &fields)
+	case tomlFrontMatterDelimiter:
+		err = toml.Unmarshal(block, &fields)
+	}
+	if err != nil {
+		return FrontMatter{}, nil, fmt.Errorf("%w: %s", ErrFrontMatterInvalid, err)
+	}
+
+	frontMatter, err := newFrontMatter(fields)
+	if err != nil {
+		return FrontMatter{}, nil, fmt.Errorf("%w: %s", ErrFrontMatterInvalid, err)
+	}
+
+	return frontMatter, body, nil
+}
+
+// Split input in a front matter block and the rest of the markdown.
+// The delimiter of the front matter is returned, or an empty string if there is no front matter.
+func splitFrontMatter(input []byte) ([]byte, []byte, string) {
+	normalized := bytes.ReplaceAll(input, []byte("\r\n"), []byte("\n"))
+
+	for _, delimiter := range []string{yamlFrontMatterDelimiter, tomlFrontMatterDelimiter} {
+		opening := delimiter + "\n"
+		if !bytes.HasPrefix(normalized, []byte(opening)) {
+			continue
+		}
+
+		rest := normalized[len(opening):]
+
+		// The closing delimiter can be directly after the opening one for an empty block.
+		if bytes.HasPrefix(rest, []byte(delimiter+"\n")) || bytes.Equal(rest, []byte(delimiter)) {
+			return nil, trimLeadingLine(rest), delimiter
+		}
+
+		end := bytes.Index(rest, []byte("\n"+delimiter+"\n"))
+		if end < 0 {
+			if !bytes.HasSuffix(rest, []byte("\n"+delimiter)) {
+				continue
+			}
+			end = len(rest) - len(delimiter) - 1
+		}
+
+		block := rest[:end]
+		body := trimLeadingLine(rest[end+1:])
+
+		return block, body, delimiter
+	}
+
+	return nil, input, ""
+}
+
+// Remove the first line from input.
+func trimLeadingLine(input []byte) []byte {
+	index := bytes.IndexByte(input, '\n')
+	if index < 0 {
+		return []byte{}
+	}
+	return input[index+1:]
+}
+
+// Create FrontMatter from the fields in a front matter block.
+func newFrontMatter(fields map[string]any) (FrontMatter, error) {
+	var (
+		frontMatter = FrontMatter{Extra: map[string]any{}}
+		err         error
+	)
+
+	for name, value := range fields {
+		switch strings.ToLower(name) {
+		case "title":
+			frontMatter.Title, err = stringField(name, value)
+		case "description":
+			frontMatter.Description, err = stringField(name, value)
+		case "author":
+			frontMatter.Author, err = stringField(name, value)
+		case "version":
+			frontMatter.Version, err = stringField(name, value)
+		case "keywords":
+			frontMatter.Keywords, err = stringsField(name, value)
+		case "last_reviewed", "lastreviewed", "last-reviewed":
+			frontMatter.LastReviewed, err = dateField(name, value)
+		default:
+			frontMatter.Extra[name] = value
+		}
+
+		if err != nil {
+			return FrontMatter{}, err
+		}
+	}
+
+	return frontMatter, nil
+}
+
+// Return value of the field called name as a string.
+// Numbers (e.g. a version like 1.2) are converted to a string.
+func stringField(name string, value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case int, int64, float64:
+		return fmt.Sprint(value), nil
+	default:
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+}
+
+// Return value of the field called name as a list of strings.
+// A single string is split on commas.
+func stringsField(name string, value any) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			v = strings.TrimSpace(v)
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+		return values, nil
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			s, err := stringField(name, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a list of strings", name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings", name)
+	}
+}
+
+// Return value of the field called name as a date.
+func dateField(name string, value any) (time.Time, error) {
+	switch value := value.(type) {
+	case time.Time:
+		// Only the date matters, so ignore the time zone the date was parsed in.
+		return time.Date(value.Year(), value.Month(), value.Day(), value.Hour(), value.Minute(), value.Second(), value.Nanosecond(), time.UTC), nil
+	case string:
+		date, err := time.Parse(frontMatterDateLayout, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s must be a date like %s", name, frontMatterDateLayout)
+		}
+		return date, nil
+	default:
+		return time.Time{}, fmt.Errorf("%s must be a date like %s", name, frontMatterDateLayout)
+	}
+}
@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	expected := FrontMatter{
+		Title:        "Installation",
+		Description:  "How to install the device",
+		LastReviewed: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+		Author:       "NeedForHeat",
+		Version:      "1.2",
+		Keywords:     []string{"install", "device"},
+		Extra:        map[string]any{"campaign_contact": "Henri"},
+	}
+
+	yamlInput := "---\ntitle: Installation\ndescription: How to install the device\nlast_reviewed: 2023-09-01\nauthor: NeedForHeat\nversion: 1.2\nkeywords: [install, device]\ncampaign_contact: Henri\n---\n# Body\n"
+	testParseFrontMatter(t, "yaml", yamlInput, expected, "# Body\n")
+
+	tomlInput := "+++\r\ntitle = \"Installation\"\r\ndescription = \"How to install the device\"\r\nlast_reviewed = 2023-09-01\r\nauthor = \"NeedForHeat\"\r\nversion = \"1.2\"\r\nkeywords = \"install, device\"\r\ncampaign_contact = \"Henri\"\r\n+++\r\n# Body\r\n"
+	testParseFrontMatter(t, "toml", tomlInput, expected, "# Body\n")
+
+	testParseFrontMatter(t, "none", "# Body\n---\n", FrontMatter{}, "# Body\n---\n")
+	testParseFrontMatter(t, "unclosed", "---\ntitle: Body\n", FrontMatter{}, "---\ntitle: Body\n")
+
+	_, _, err := parseFrontMatter([]byte("---\nlast_reviewed: yesterday\n---\n"))
+	if !errors.Is(err, ErrFrontMatterInvalid) {
+		t.Fatalf("expected %v, got %v", ErrFrontMatterInvalid, err)
+	}
+}
+
+func testParseFrontMatter(t *testing.T, name string, input string, expected FrontMatter, expectedBody string) {
+	t.Run(name, func(t *testing.T) {
+		frontMatter, body, err := parseFrontMatter([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(frontMatter, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, frontMatter)
+		}
+
+		if string(body) != expectedBody {
+			t.Fatalf("expected body %q, got %q", expectedBody, string(body))
+		}
+	})
+}
@@ -0,0 +1,471 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+)
+
+const (
+	// Directory in the destination filesystem where processed images are cached between parses.
+	imageCacheDir = "image_cache"
+
+	// Name of the file in a cache entry that describes the processed images.
+	imageCacheManifestFileName = "image.json"
+
+	defaultJPEGQuality = 85
+	defaultImageSizes  = "(max-width: 800px) 100vw, 800px"
+
+	// Maximum number of pixels of an image that is processed, because a decoded image is kept in memory.
+	// Larger images are used without processing them, with only their metadata removed.
+	maxProcessedImagePixels = 50000000
+)
+
+var (
+	ErrImageWidthInvalid = errors.New("image width is invalid")
+	ErrImageTooLarge     = errors.New("image is too large to process")
+
+	// Widths of resized variants that are generated by default.
+	DefaultImageWidths = []int{400, 800, 1600}
+)
+
+// ImageOptions for processing JPEG and PNG images in manuals.
+//
+// Processed images are decoded and encoded again, which strips all metadata, such as EXIF data
+// with the GPS coordinates of where a photo was taken. The EXIF orientation of JPEG images is applied first.
+// The metadata of images that are not processed is removed without encoding them again.
+type ImageOptions struct {
+	// Widths in pixels of resized variants to generate for every image.
+	// Images are not processed when it is empty.
+	Widths []int
+
+	// Quality of encoded JPEG images, from 1 to 100. Defaults to 85.
+	JPEGQuality int
+
+	// Encode PNG images without transparency as JPEG, which is much smaller for photos.
+	ConvertToJPEG bool
+
+	// Sizes attribute of images with resized variants. Defaults to '(max-width: 800px) 100vw, 800px'.
+	Sizes string
+}
+
+// A processedImage is an encoded image, which is the full image or one of its resized variants.
+type processedImage struct {
+	// Name of the file in the cache entry.
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Whether this is a resized variant.
+	Variant bool `json:"variant"`
+}
+
+// A processedImageSet contains an image and its resized variants, which are cached in dir.
+type processedImageSet struct {
+	dir string
+
+	// Key based on the contents of the original image and the image options.
+	key string
+
+	// Full is the image with its original size, Variants are sorted by width.
+	Full     processedImage   `json:"full"`
+	Variants []processedImage `json:"variants"`
+	Ext      string           `json:"ext"`
+}
+
+// Parse a comma separated list of image widths from s (e.g. '400,800,1600').
+// An empty list is returned for 'none', which disables processing images.
+func ParseImageWidths(s string) ([]int, error) {
+	if s == "none" {
+		return []int{}, nil
+	}
+
+	var widths []int
+	for _, field := range strings.Split(s, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("%w: %q", ErrImageWidthInvalid, field)
+		}
+
+		widths = append(widths, width)
+	}
+
+	return widths, nil
+}
+
+// Returns if images have to be processed.
+func (p *Parser) processImages() bool {
+	return len(p.options.Images.Widths) > 0
+}
+
+// Report if the image at source is used without processing it, because it is too large to process.
+// A warning is added to the report for the file at filePath that uses the image.
+func (p *Parser) skipImageProcessing(source string, filePath string, err error) bool {
+	if !errors.Is(err, ErrImageTooLarge) {
+		return false
+	}
+
+	p.warn(p.buildError(filePath, StageImages, fmt.Errorf("using image %s without processing it: %w", source, err)))
+	return true
+}
+
+// Returns if an image file with extension can be processed.
+func isProcessableImage(extension string) bool {
+	switch strings.ToLower(strings.TrimPrefix(extension, ".")) {
+	case "jpg", "jpeg", "png":
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns if an image with data can be processed.
+func isProcessableImageData(data []byte) bool {
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png":
+		return true
+	default:
+		return false
+	}
+}
+
+// Process the image with data. Variants are only generated if withVariants is set,
+// and PNG images are only converted to JPEG if convert is set.
+// ErrImageTooLarge is returned for an image with more than 50 million pixels.
+//
+// The processed images are cached in the destination filesystem by the contents of data and the image options,
+// so parsing again does not process the same image again.
+func (p *Parser) processImage(data []byte, withVariants bool, convert bool) (*processedImageSet, error) {
+	options := p.options.Images
+	if options.JPEGQuality <= 0 {
+		options.JPEGQuality = defaultJPEGQuality
+	}
+	if !withVariants {
+		options.Widths = nil
+	}
+	options.ConvertToJPEG = options.ConvertToJPEG && convert
+
+	hash := sha256.New()
+	hash.Write(data)
+	fmt.Fprintf(hash, "%v %d %t", options.Widths, options.JPEGQuality, options.ConvertToJPEG)
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	set := &processedImageSet{
+		dir: path.Join(imageCacheDir, key),
+		key: key,
+	}
+
+	p.usedImages[key] = true
+
+	manifest, err := fs.ReadFile(p.destFS, path.Join(set.dir, imageCacheManifestFileName))
+	if err == nil && json.Unmarshal(manifest, set) == nil {
+		return set, nil
+	}
+
+	// Check the size before decoding, so a small file cannot make the parser allocate a huge image.
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > maxProcessedImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels is more than %d", ErrImageTooLarge, config.Width, config.Height, maxProcessedImagePixels)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	full := toRGBA(img)
+
+	set.Ext = format
+	if format == "jpeg" || (options.ConvertToJPEG && full.Opaque()) {
+		set.Ext = "jpg"
+	}
+
+	err = wfs.MkdirAll(p.destFS, set.dir, fs.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	set.Full, err = p.writeProcessedImage(set, "full", full, options.JPEGQuality)
+	if err != nil {
+		return nil, err
+	}
+
+	widths := append([]int{}, options.Widths...)
+	sort.Ints(widths)
+
+	for _, width := range widths {
+		if width <= 0 || width >= full.Bounds().Dx() {
+			continue
+		}
+
+		variant, err := p.writeProcessedImage(set, strconv.Itoa(width)+"w", resize(full, width), options.JPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+		variant.Variant = true
+
+		set.Variants = append(set.Variants, variant)
+	}
+
+	manifest, err = json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wfs.WriteFile(p.destFS, path.Join(set.dir, imageCacheManifestFileName), manifest, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// Encode img and write it to the cache entry of set with name.
+func (p *Parser) writeProcessedImage(set *processedImageSet, name string, img *image.RGBA, quality int) (processedImage, error) {
+	var buf bytes.Buffer
+	var err error
+
+	if set.Ext == "jpg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return processedImage{}, err
+	}
+
+	processed := processedImage{
+		Name:   name + "." + set.Ext,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+
+	err = wfs.WriteFile(p.destFS, path.Join(set.dir, processed.Name), buf.Bytes(), 0644)
+	return processed, err
+}
+
+// Read the encoded data of img in set from the cache.
+func (p *Parser) readProcessedImage(set *processedImageSet, img processedImage) ([]byte, error) {
+	return fs.ReadFile(p.destFS, path.Join(set.dir, img.Name))
+}
+
+// Remove cached images that were not used by the last parse.
+func (p *Parser) pruneImageCache() error {
+	entries, err := fs.ReadDir(p.destFS, imageCacheDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if p.usedImages[entry.Name()] {
+			continue
+		}
+
+		err = wfs.RemoveAll(p.destFS, path.Join(imageCacheDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Convert img to an *image.RGBA with bounds starting at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// Resize src to width, keeping its aspect ratio.
+//
+// Every pixel is the average of the pixels of src it covers, which is good enough for downscaling photos.
+func resize(src *image.RGBA, width int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	height := (srcHeight*width + srcWidth/2) / srcWidth
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := (y + 1) * srcHeight / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := (x + 1) * srcWidth / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					sum[0] += int(src.Pix[i])
+					sum[1] += int(src.Pix[i+1])
+					sum[2] += int(src.Pix[i+2])
+					sum[3] += int(src.Pix[i+3])
+					i += 4
+				}
+			}
+
+			count := (x1 - x0) * (y1 - y0)
+			j := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[j+c] = uint8((sum[c] + count/2) / count)
+			}
+		}
+	}
+
+	return dst
+}
+
+// Return the EXIF orientation of the JPEG image with data, from 1 to 8.
+// Returns 1 (normal) if the image has no orientation.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of scan or end of image, there is no metadata after this.
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// Return the orientation in tiff, the TIFF structure of EXIF data.
+// Returns 1 (normal) if it has no valid orientation.
+func exifOrientation(tiff []byte) int {
+	const orientationTag = 0x0112
+
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// Rotate and flip img according to EXIF orientation, so it is displayed correctly without its metadata.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		// Orientations 5 to 8 are rotated by 90 degrees.
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Flipped horizontally.
+				dx, dy = width-1-x, y
+			case 3: // Rotated 180 degrees.
+				dx, dy = width-1-x, height-1-y
+			case 4: // Flipped vertically.
+				dx, dy = x, height-1-y
+			case 5: // Transposed.
+				dx, dy = y, x
+			case 6: // Rotated 90 degrees clockwise.
+				dx, dy = height-1-y, x
+			case 7: // Transversed.
+				dx, dy = height-1-y, width-1-x
+			case 8: // Rotated 90 degrees counterclockwise.
+				dx, dy = y, width-1-x
+			}
+
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/fs"
+	"testing"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+// Create a JPEG image with width and height that has EXIF orientation.
+func newTestJPEG(t *testing.T, width int, height int, orientation byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.White)
+	}
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Little endian TIFF header with one IFD entry: orientation (0x0112), type short, count 1.
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0, 0x12, 0x01, 3, 0, 1, 0, 0, 0, orientation, 0, 0, 0, 0, 0, 0, 0}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(segment) + 2
+	app1 := append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, segment...)
+
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	data := newTestJPEG(t, 4, 2, 6)
+
+	orientation := jpegOrientation(data)
+	if orientation != 6 {
+		t.Fatalf("expected orientation 6, got %d", orientation)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := applyOrientation(img, orientation)
+	if rotated.Bounds().Dx() != 2 || rotated.Bounds().Dy() != 4 {
+		t.Fatalf("expected a 2x4 image, got %v", rotated.Bounds())
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	p := New(dirfs.New(t.TempDir()), Options{
+		Images: ImageOptions{Widths: []int{100, 400, 1600}},
+	})
+	p.usedImages = map[string]bool{}
+
+	data := newTestJPEG(t, 1000, 500, 6)
+
+	set, err := p.processImage(data, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if set.Ext != "jpg" || set.Full.Width != 500 || set.Full.Height != 1000 {
+		t.Fatalf("expected a 500x1000 jpg, got a %dx%d %s", set.Full.Width, set.Full.Height, set.Ext)
+	}
+
+	if len(set.Variants) != 2 || set.Variants[0].Width != 100 || set.Variants[0].Height != 200 || set.Variants[1].Width != 400 {
+		t.Fatalf("expected variants with widths 100 and 400, got %+v", set.Variants)
+	}
+
+	full, err := p.readProcessedImage(set, set.Full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if jpegOrientation(full) != 1 || bytes.Contains(full, []byte("Exif")) {
+		t.Fatal("expected EXIF data to be stripped")
+	}
+
+	cached, err := p.processImage(data, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cached.Full != set.Full || len(cached.Variants) != len(set.Variants) {
+		t.Fatalf("expected the cached image to be the same, got %+v", cached)
+	}
+}
+
+// Create a PNG image that claims to be width by height pixels, without the image data.
+func newTestPNGHeader(width uint32, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 2 // truecolor
+
+	return append([]byte("\x89PNG\r\n\x1a\n"), newTestPNGChunk("IHDR", ihdr)...)
+}
+
+// Create a PNG chunk of type chunkType with data.
+func newTestPNGChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestProcessImageTooLarge(t *testing.T) {
+	// The metadata of an image that is too large to process is still removed.
+	expected := newTestPNGHeader(10000, 10000)
+	data := append(append([]byte{}, expected...), newTestPNGChunk("tEXt", []byte("GPS\x0052.22,6.89"))...)
+
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/en-US.md": "# FAQ\n\n![large](../assets/large.png)\n",
+		"campaigns/generic/faq/assets/large.png":   string(data),
+	})
+
+	for _, mode := range []ImageMode{ImageModeFiles, ImageModeInline} {
+		t.Run(string(mode), func(t *testing.T) {
+			p := New(dirfs.New(t.TempDir()), Options{
+				ImageMode: mode,
+				Images:    ImageOptions{Widths: []int{400}},
+			})
+
+			err := p.Parse(sourceFS)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			current, err := p.Current()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if mode == ImageModeFiles {
+				written, err := fs.ReadFile(current, "campaigns/generic/faq/assets/"+hashedAssetName("large.png", expected))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(written, expected) {
+					t.Error("expected the image to be used without processing it, with its metadata removed")
+				}
+			} else {
+				manual, err := fs.ReadFile(current, "campaigns/generic/faq/en-US/index.html")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(manual, []byte(base64.StdEncoding.EncodeToString(expected))) {
+					t.Error("expected the image to be inlined without processing it, with its metadata removed")
+				}
+			}
+
+			copied, err := fs.ReadFile(current, "campaigns/generic/faq/assets/large.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(copied, expected) {
+				t.Error("expected the image to be copied without processing it, with its metadata removed")
+			}
+
+			warnings := p.Report().Warnings
+			if len(warnings) != 2 || warnings[0].Stage != StageImages || !errors.Is(warnings[0], ErrImageTooLarge) {
+				t.Errorf("expected a warning for the manual and the copied image, got %v", warnings)
+			}
+		})
+	}
+}
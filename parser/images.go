@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// ImageMode sets how images in manuals are included in the generated HTML.
+type ImageMode string
+
+const (
+	// Images are inlined as base64 data URIs, so every manual is a single file that can be used offline.
+	// This is what an empty ImageMode in Options means, but the server and the static site export use ImageModeFiles by default.
+	ImageModeInline ImageMode = "inline"
+
+	// Images are written to content-hashed files in the assets directory of the manual,
+	// so they can be cached separately and are shared between languages.
+	ImageModeFiles ImageMode = "files"
+)
+
+const (
+	// Name of the directory next to the language directories that images are written to.
+	assetsDirName = "assets"
+
+	// Number of hexadecimal characters of the content hash in the name of an image file.
+	assetHashLength = 16
+)
+
+var (
+	ErrImageModeInvalid = errors.New("image mode is invalid")
+
+	// Matches names of content-hashed files (e.g. 'meter.0123456789abcdef.png').
+	hashedAssetRegExp = regexp.MustCompile(`\.[0-9a-f]{16}\.[0-9A-Za-z]+$`)
+
+	// Matches characters that are not kept in the name of an image file.
+	assetNameRegExp = regexp.MustCompile(`[^0-9A-Za-z_-]+`)
+)
+
+// Parse an image mode from s.
+func ParseImageMode(s string) (ImageMode, error) {
+	switch mode := ImageMode(s); mode {
+	case ImageModeInline, ImageModeFiles:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: %q, use %q or %q", ErrImageModeInvalid, s, ImageModeInline, ImageModeFiles)
+	}
+}
+
+// Returns if the file at filePath is a content-hashed file written by the parser.
+// Its contents never change, so it can be cached forever.
+func IsHashedAsset(filePath string) bool {
+	dir, file := path.Split(filePath)
+	return path.Base(dir) == assetsDirName && hashedAssetRegExp.MatchString(file)
+}
+
+// Include the images in doc, of the markdown file at filePath with destination destFilePath,
+// according to the image mode of the parser.
+func (p *Parser) includeImages(doc ast.Node, sourceFS fs.FS, filePath string, destFilePath string) (ast.Node, error) {
+	if p.options.ImageMode == ImageModeFiles {
+		return p.writeImages(doc, sourceFS, filePath, destFilePath)
+	}
+
+	return p.base64EncodeImages(doc, sourceFS, filePath)
+}
+
+// Process the image with data for inlining. The largest resized variant is used,
+// because the full size image is usually much larger than needed.
+//
+// The processed data and its extension are returned.
+func (p *Parser) inlineProcessedImage(data []byte) ([]byte, string, error) {
+	set, err := p.processImage(data, true, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	processed := set.Full
+	if len(set.Variants) > 0 {
+		processed = set.Variants[len(set.Variants)-1]
+	}
+
+	processedData, err := p.readProcessedImage(set, processed)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Data URIs use image/jpeg as media type.
+	extension := set.Ext
+	if extension == "jpg" {
+		extension = "jpeg"
+	}
+
+	return processedData, extension, nil
+}
+
+// Write all images in doc to content-hashed files in the assets directory of the manual
+// and point the images to them.
+//
+// Remote images that cannot be downloaded keep their URL.
+// An error is returned for the first other image that could not be read or written.
+func (p *Parser) writeImages(doc ast.Node, sourceFS fs.FS, filePath string, destFilePath string) (ast.Node, error) {
+	// e.g. devices/<device>/<manual_type>/<campaign>/languages/<lang>.md
+	assetsDir := path.Join(path.Dir(path.Dir(destFilePath)), assetsDirName)
+
+	var imageErr error
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		img, ok := node.(*ast.Image)
+		if !ok || !entering || strings.HasPrefix(string(img.Destination), "data:") {
+			return ast.GoToNext
+		}
+
+		imageData, err := p.readImage(string(img.Destination), sourceFS, filePath)
+		if p.keepRemoteImage(string(img.Destination), filePath, err) {
+			return ast.GoToNext
+		}
+		if err != nil {
+			imageErr = fmt.Errorf("error reading image %s: %w", img.Destination, err)
+			return ast.Terminate
+		}
+
+		imageData = stripImageMetadata(imageData)
+
+		err = wfs.MkdirAll(p.stagingFS, assetsDir, fs.ModePerm)
+		if err != nil {
+			imageErr = fmt.Errorf("error writing image %s: %w", img.Destination, err)
+			return ast.Terminate
+		}
+
+		if p.processImages() && isProcessableImageData(imageData) {
+			err = p.writeProcessedImages(img, assetsDir, imageData)
+			if err == nil {
+				return ast.GoToNext
+			}
+			if !p.skipImageProcessing(string(img.Destination), filePath, err) {
+				imageErr = fmt.Errorf("error processing image %s: %w", img.Destination, err)
+				return ast.Terminate
+			}
+		}
+
+		name := hashedAssetName(string(img.Destination), imageData)
+
+		err = wfs.WriteFile(p.stagingFS, path.Join(assetsDir, name), imageData, 0644)
+		if err != nil {
+			imageErr = fmt.Errorf("error writing image %s: %w", img.Destination, err)
+			return ast.Terminate
+		}
+
+		// The manual is served from a language directory next to the assets directory.
+		img.Destination = []byte("../" + assetsDirName + "/" + name)
+
+		return ast.GoToNext
+	})
+
+	return doc, imageErr
+}
+
+// Report if the image at source keeps its URL, because it is a remote image that could not be downloaded.
+// A warning is added to the report, unless the image was not downloaded because the parser is offline.
+func (p *Parser) keepRemoteImage(source string, filePath string, err error) bool {
+	if err == nil || !isRemote(source) {
+		return false
+	}
+
+	if !errors.Is(err, errRemoteOffline) {
+		p.warn(p.buildError(filePath, StageImages, fmt.Errorf("keeping the URL of remote image %s: %w", source, err)))
+	}
+
+	return true
+}
+
+// Process the image with data, write it and its resized variants to assetsDir
+// and point img to them using src and srcset attributes.
+func (p *Parser) writeProcessedImages(img *ast.Image, assetsDir string, data []byte) error {
+	set, err := p.processImage(data, true, true)
+	if err != nil {
+		return err
+	}
+
+	var srcset []string
+	for _, processed := range append(set.Variants, set.Full) {
+		processedData, err := p.readProcessedImage(set, processed)
+		if err != nil {
+			return err
+		}
+
+		name := processedAssetName(string(img.Destination), set, processed)
+
+		err = wfs.WriteFile(p.stagingFS, path.Join(assetsDir, name), processedData, 0644)
+		if err != nil {
+			return err
+		}
+
+		srcset = append(srcset, "../"+assetsDirName+"/"+name+" "+strconv.Itoa(processed.Width)+"w")
+	}
+
+	sizes := p.options.Images.Sizes
+	if sizes == "" {
+		sizes = defaultImageSizes
+	}
+
+	attrs := map[string][]byte{
+		"width":  []byte(strconv.Itoa(set.Full.Width)),
+		"height": []byte(strconv.Itoa(set.Full.Height)),
+	}
+	if len(set.Variants) > 0 {
+		attrs["srcset"] = []byte(strings.Join(srcset, ", "))
+		attrs["sizes"] = []byte(sizes)
+	}
+	img.Attribute = &ast.Attribute{Attrs: attrs}
+
+	// The manual is served from a language directory next to the assets directory.
+	img.Destination = []byte("../" + assetsDirName + "/" + processedAssetName(string(img.Destination), set, set.Full))
+
+	return nil
+}
+
+// Return the name for the content-hashed file of the image at source with data
+// (e.g. 'meter.0123456789abcdef.png').
+func hashedAssetName(source string, data []byte) string {
+	if sourceURL, err := url.Parse(source); err == nil {
+		source = sourceURL.Path
+	}
+
+	extension := strings.TrimPrefix(path.Ext(source), ".")
+	if extension == "" {
+		extension = imageExtension(sniffImageType(data, source))
+	}
+
+	hash := sha256.Sum256(data)
+
+	return assetStem(source) + "." + hex.EncodeToString(hash[:])[:assetHashLength] + "." + strings.ToLower(extension)
+}
+
+// Return the file extension for an image with contentType, without a dot.
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return "jpg"
+	case "image/svg+xml":
+		return "svg"
+	}
+
+	extensions, _ := mime.ExtensionsByType(contentType)
+	if len(extensions) == 0 {
+		return "bin"
+	}
+
+	return strings.TrimPrefix(extensions[0], ".")
+}
+
+// Return the name for the file of processed image img in set, of the image at source
+// (e.g. 'meter.0123456789abcdef.jpg' or 'meter-800w.0123456789abcdef.jpg' for a resized variant).
+func processedAssetName(source string, set *processedImageSet, img processedImage) string {
+	if sourceURL, err := url.Parse(source); err == nil {
+		source = sourceURL.Path
+	}
+
+	stem := assetStem(source)
+	if img.Variant {
+		stem += "-" + strconv.Itoa(img.Width) + "w"
+	}
+
+	return stem + "." + set.key[:assetHashLength] + "." + set.Ext
+}
+
+// Return the name of the file at source without its extension and characters that are not safe in a URL.
+func assetStem(source string) string {
+	stem := strings.TrimSuffix(path.Base(source), path.Ext(source))
+	stem = strings.Trim(assetNameRegExp.ReplaceAllString(stem, "-"), "-")
+	if stem == "" {
+		stem = "image"
+	}
+
+	return stem
+}
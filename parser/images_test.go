@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestHashedAssetName(t *testing.T) {
+	data := []byte("image")
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"../assets/meter.png", "meter.6105d6cc76af4003.png"},
+		{"../assets/Photo 1.JPG", "Photo-1.6105d6cc76af4003.jpg"},
+		{"https://example.com/images/meter.png?size=large", "meter.6105d6cc76af4003.png"},
+	}
+
+	for _, test := range tests {
+		name := hashedAssetName(test.source, data)
+		if name != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.source, test.expected, name)
+		}
+
+		if !IsHashedAsset("devices/smart-meter/installation/generic/assets/" + name) {
+			t.Errorf("%s: expected %s to be a hashed asset", test.source, name)
+		}
+	}
+
+	if IsHashedAsset("devices/smart-meter/installation/generic/assets/meter.png") {
+		t.Error("expected meter.png not to be a hashed asset")
+	}
+}
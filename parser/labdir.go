@@ -1,18 +1,29 @@
 package parser
 
 import (
+	"context"
 	"io/fs"
+	"log"
 	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
+// Time to wait for more filesystem events before reporting a change,
+// so saving multiple files at once only results in a single change.
+const watchDebounce = 500 * time.Millisecond
+
 // LabDirSource is a local directory that contains manuals made by a lab.
 type LabDirSource struct {
 	fs.FS
+	path string
 }
 
 // Create a new source filesystem from a directory at path.
 func NewLabDirSource(path string) (fs.FS, error) {
-	return LabDirSource{os.DirFS(path)}, nil
+	return LabDirSource{os.DirFS(path), path}, nil
 }
 
 // Get the path to copy a file to at the destination filesystem.
@@ -26,3 +37,74 @@ func (dir LabDirSource) GetDestinationFilePath(filePath string) string {
 func (dir LabDirSource) GetDestinationDirPath(dirPath string) string {
 	return dirPath
 }
+
+// Watch the directory and all its subdirectories for changes and report them on changed,
+// until ctx is cancelled.
+//
+// Changes are reported by the operating system, so pollInterval is not used.
+func (dir LabDirSource) Watch(ctx context.Context, pollInterval time.Duration, changed chan<- struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	err = addWatchRecursive(watcher, dir.path)
+	if err != nil {
+		return err
+	}
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Has(fsnotify.Create) {
+				// New directories have to be watched as well.
+				info, err := os.Stat(event.Name)
+				if err == nil && info.IsDir() {
+					err = addWatchRecursive(watcher, event.Name)
+					if err != nil {
+						log.Println("error watching", event.Name+":", err)
+					}
+				}
+			}
+
+			debounce.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Println("error watching", dir.path+":", err)
+		case <-debounce.C:
+			notify(changed)
+		}
+	}
+}
+
+// Add root and all directories below it to watcher.
+func addWatchRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		return watcher.Add(path)
+	})
+}
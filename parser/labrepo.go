@@ -1,24 +1,30 @@
 package parser
 
 import (
+	"context"
 	"io/fs"
+	"log"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
 // LabRepoSource is a git repo that contains manuals made by a lab.
 type LabRepoSource struct {
-	fs.FS
+	*gitRepo
 }
 
-// Create a new source filesystem from a directory at path.
-func NewLabRepoSource(url string, branch string, auth transport.AuthMethod) (fs.FS, error) {
-	gitFS, _, err := newGitFSWithAuth(url, branch, auth)
+// Create a new source filesystem from a git repo at url.
+//
+// The default branch is cloned, unless branch or ref is set.
+// ref can be a tag or a commit hash to pin the source to a specific revision.
+func NewLabRepoSource(url string, branch string, ref string, auth transport.AuthMethod) (fs.FS, error) {
+	repo, err := newGitFSWithAuth(url, branch, ref, auth)
 	if err != nil {
 		return nil, err
 	}
 
-	return LabRepoSource{gitFS}, nil
+	return LabRepoSource{repo}, nil
 }
 
 // Get the path to copy a file to at the destination filesystem.
@@ -32,3 +38,36 @@ func (repo LabRepoSource) GetDestinationFilePath(filePath string) string {
 func (repo LabRepoSource) GetDestinationDirPath(dirPath string) string {
 	return dirPath
 }
+
+// Watch polls the remote repository every pollInterval and reports on changed
+// when new commits were fetched, until ctx is cancelled.
+// The new commits are staged, and only used once they are installed when the source is parsed again.
+//
+// A repository that is pinned to a tag or commit is not polled.
+func (repo LabRepoSource) Watch(ctx context.Context, pollInterval time.Duration, changed chan<- struct{}) error {
+	if repo.pinned() {
+		log.Println("not checking", RedactURL(repo.url), "for new commits, because it is pinned to", repo.Revision().Reference)
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			updated, err := repo.update(ctx)
+			if err != nil {
+				log.Println("error updating", repo.url+":", err)
+				continue
+			}
+
+			if updated {
+				notify(changed)
+			}
+		}
+	}
+}
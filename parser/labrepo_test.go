@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+// Matches the version of a test manual.
+var testVersionRegExp = regexp.MustCompile(`version (\d+)`)
+
+func TestLabRepoSourceWatchWhileParsing(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repoDir := t.TempDir()
+	manuals := []string{
+		"campaigns/generic/faq/languages/en-US.md",
+		"campaigns/generic/installation/languages/en-US.md",
+		"campaigns/winter/faq/languages/en-US.md",
+	}
+
+	git := func(args ...string) {
+		runGit(t, repoDir, args...)
+	}
+
+	commit := func(version int) {
+		for _, manual := range manuals {
+			fullPath := filepath.Join(repoDir, filepath.FromSlash(manual))
+
+			err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = os.WriteFile(fullPath, []byte(fmt.Sprintf("# Manual\n\nversion %d\n", version)), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		git("add", "-A")
+		git("commit", "-q", "-m", fmt.Sprintf("version %d", version))
+	}
+
+	git("init", "-q", "-b", "main")
+	commit(0)
+
+	sourceFS, err := NewLabRepoSource("file://"+filepath.ToSlash(repoDir), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(sourceFS)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Watch(ctx, sourceFS, time.Millisecond, changed)
+	}()
+	defer wg.Wait()
+	defer cancel()
+
+	p := New(dirfs.New(t.TempDir()), Options{Resilient: true})
+
+	for version := 1; version <= 5; version++ {
+		commit(version)
+
+		// Parse while the new commit is being fetched.
+		for i := 0; i < 5; i++ {
+			err = p.Parse(sourceFS)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if errs := p.Report().Errors; len(errs) > 0 {
+				t.Fatalf("expected no skipped files, got %v", errs[0])
+			}
+
+			current, err := p.Current()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkSingleVersion(t, current)
+		}
+	}
+
+	// The last commit is used once it was fetched.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		err = p.Parse(sourceFS)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		current, err := p.Current()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if checkSingleVersion(t, current) == "5" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the last commit to be parsed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLabRepoSourceHexTag(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repoDir := t.TempDir()
+	manual := filepath.Join(repoDir, "campaigns", "generic", "faq", "languages", "en-US.md")
+
+	commit := func(version int) string {
+		err := os.MkdirAll(filepath.Dir(manual), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(manual, []byte(fmt.Sprintf("# FAQ\n\nversion %d\n", version)), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		runGit(t, repoDir, "add", "-A")
+		runGit(t, repoDir, "commit", "-q", "-m", fmt.Sprintf("version %d", version))
+		return runGit(t, repoDir, "rev-parse", "HEAD")
+	}
+
+	runGit(t, repoDir, "init", "-q", "-b", "main")
+	first := commit(1)
+	// A tag that looks like an abbreviated commit hash.
+	runGit(t, repoDir, "tag", "2023100")
+	second := commit(2)
+
+	tests := []struct {
+		ref       string
+		reference string
+		commit    string
+	}{
+		{"2023100", "refs/tags/2023100", first},
+		{second[:7], second[:7], second},
+		{first, first, first},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			sourceFS, err := NewLabRepoSource("file://"+filepath.ToSlash(repoDir), "", test.ref, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer Close(sourceFS)
+
+			revision, err := GetRevision(sourceFS)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if revision.Reference != test.reference || revision.Commit != test.commit {
+				t.Fatalf("expected reference %s at %s, got %s at %s", test.reference, test.commit, revision.Reference, revision.Commit)
+			}
+		})
+	}
+}
+
+// Run git with args in dir and return its trimmed output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, output)
+	}
+
+	return strings.TrimSpace(string(output))
+}
+
+// Check that every manual in fsys has the same version, so it was parsed from a single commit,
+// and return the version.
+func checkSingleVersion(t *testing.T, fsys fs.FS) string {
+	t.Helper()
+
+	versions := map[string]bool{}
+
+	err := fs.WalkDir(fsys, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || filepath.Base(filePath) != "index.html" {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, filePath)
+		if err != nil {
+			return err
+		}
+
+		if match := testVersionRegExp.FindSubmatch(data); match != nil {
+			versions[string(match[1])] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 1 {
+		t.Fatalf("expected manuals from a single commit, got versions %v", versions)
+	}
+
+	for version := range versions {
+		return version
+	}
+	return ""
+}
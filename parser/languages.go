@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+const (
+	// Name of the file in a campaign directory that sets the fallback languages of the campaign's manuals.
+	// It contains a JSON array of language codes (e.g. ["nl-NL", "nl-BE"]).
+	FallbackLanguagesFileName = "fallback_languages.json"
+)
+
+var (
+	ErrFallbackLanguagesEmpty = errors.New("there are no fallback languages")
+)
+
+// A TemplateLanguage is another language a manual is available in, to render a language switcher.
+type TemplateLanguage struct {
+	// Language code (e.g. nl-NL).
+	Language string
+	// Name of the language in the language itself (e.g. Nederlands).
+	Name string
+	// URL that switches to the language, relative to the manual (e.g. ../?lang=nl-NL).
+	// The server remembers the chosen language for other manuals.
+	URL string
+}
+
+// Parse a comma separated list of language codes (e.g. nl-BE,nl-NL,en-US) to a fallback chain.
+func ParseFallbackLanguages(s string) ([]language.Tag, error) {
+	var fallbacks []language.Tag
+
+	for _, lang := range strings.Split(s, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang == "" {
+			continue
+		}
+
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", lang, err)
+		}
+
+		fallbacks = append(fallbacks, tag)
+	}
+
+	if len(fallbacks) == 0 {
+		return nil, ErrFallbackLanguagesEmpty
+	}
+
+	return fallbacks, nil
+}
+
+// Parse the contents of a fallback_languages.json file.
+func parseFallbackLanguagesFile(data []byte) ([]language.Tag, error) {
+	var langs []string
+	err := json.Unmarshal(data, &langs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(langs) == 0 {
+		return nil, ErrFallbackLanguagesEmpty
+	}
+
+	fallbacks := make([]language.Tag, 0, len(langs))
+	for _, lang := range langs {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", lang, err)
+		}
+
+		fallbacks = append(fallbacks, tag)
+	}
+
+	return fallbacks, nil
+}
+
+// Read the fallback languages of campaign from its fallback_languages.json file in fsys.
+// Returns nil if campaign is empty or has no fallback languages file.
+func CampaignFallbackLanguages(fsys fs.FS, campaign string) ([]language.Tag, error) {
+	if campaign == "" {
+		return nil, nil
+	}
+
+	data, err := fs.ReadFile(fsys, path.Join("campaigns", campaign, FallbackLanguagesFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFallbackLanguagesFile(data)
+}
+
+// Return the name of the campaign in filePath, which is a URL path or a path in a lab's manual source,
+// or an empty string if there is none.
+func CampaignFromPath(filePath string) string {
+	splitPath := strings.Split(strings.Trim(filePath, "/"), "/")
+
+	switch splitPath[0] {
+	case "campaigns":
+		if len(splitPath) >= 2 {
+			return splitPath[1]
+		}
+	case "devices", "energy_queries", "cloud_feeds":
+		if len(splitPath) >= 4 {
+			return splitPath[3]
+		}
+	}
+
+	return ""
+}
+
+// Return languages sorted in the order they are preferred when a client's languages do not match any of them:
+// first the languages in fallbacks, in the order of fallbacks, then the other languages alphabetically.
+//
+// Languages only match a fallback language exactly, so en does not match en-US.
+func SortLanguages(languages []language.Tag, fallbacks []language.Tag) []language.Tag {
+	rank := func(tag language.Tag) int {
+		for i, fallback := range fallbacks {
+			if tag == fallback {
+				return i
+			}
+		}
+		return len(fallbacks)
+	}
+
+	sorted := append([]language.Tag(nil), languages...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		rankI, rankJ := rank(sorted[i]), rank(sorted[j])
+		if rankI != rankJ {
+			return rankI < rankJ
+		}
+		return sorted[i].String() < sorted[j].String()
+	})
+
+	return sorted
+}
+
+// Return the languages of the manuals in the languages directory dirPath in sourceFS,
+// except lang, sorted by language code.
+func otherLanguages(sourceFS fs.FS, dirPath string, lang string) ([]TemplateLanguage, error) {
+	entries, err := fs.ReadDir(sourceFS, dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	languages := []TemplateLanguage{}
+
+	for _, entry := range entries {
+		if !isMarkdownFile(entry) {
+			continue
+		}
+
+		other := strings.TrimSuffix(entry.Name(), ".md")
+		tag, err := language.Parse(other)
+		if err != nil || other == lang {
+			continue
+		}
+
+		languages = append(languages, TemplateLanguage{
+			Language: other,
+			Name:     display.Self.Name(tag),
+			URL:      "../?" + url.Values{"lang": {other}}.Encode(),
+		})
+	}
+
+	return languages, nil
+}
+
+// Check the fallback languages file at filePath in sourceFS and copy it to the staging filesystem.
+func (p *Parser) copyFallbackLanguages(sourceFS fs.FS, filePath string) error {
+	data, err := fs.ReadFile(sourceFS, filePath)
+	if err != nil {
+		return p.buildError(filePath, StageRead, err)
+	}
+
+	_, err = parseFallbackLanguagesFile(data)
+	if err != nil {
+		return p.buildError(filePath, StageFallbacks, err)
+	}
+
+	return p.copyFileToDest(sourceFS, filePath)
+}
+
+func isFallbackLanguagesFile(filePath string) bool {
+	matched, _ := path.Match("campaigns/*/"+FallbackLanguagesFileName, filePath)
+	return matched
+}
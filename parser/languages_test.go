@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/text/language"
+)
+
+func TestSortLanguages(t *testing.T) {
+	fallbacks, err := ParseFallbackLanguages("nl-BE, nl-NL,en-US")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	languages := []language.Tag{
+		language.MustParse("fr-FR"),
+		language.MustParse("en-US"),
+		language.MustParse("de-DE"),
+		language.MustParse("nl-NL"),
+	}
+
+	sorted := SortLanguages(languages, fallbacks)
+
+	expected := []language.Tag{
+		language.MustParse("nl-NL"),
+		language.MustParse("en-US"),
+		language.MustParse("de-DE"),
+		language.MustParse("fr-FR"),
+	}
+
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Fatalf("expected %v, got %v", expected, sorted)
+	}
+
+	if _, err := ParseFallbackLanguages(" , "); !errors.Is(err, ErrFallbackLanguagesEmpty) {
+		t.Fatalf("expected %v, got %v", ErrFallbackLanguagesEmpty, err)
+	}
+}
+
+func TestCampaignFallbackLanguages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"campaigns/dutch/fallback_languages.json": {Data: []byte(`["nl-NL", "nl-BE"]`)},
+		"campaigns/empty/fallback_languages.json": {Data: []byte(`[]`)},
+	}
+
+	fallbacks, err := CampaignFallbackLanguages(fsys, CampaignFromPath("/devices/smart-meter/installation/dutch/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []language.Tag{language.MustParse("nl-NL"), language.MustParse("nl-BE")}
+	if !reflect.DeepEqual(fallbacks, expected) {
+		t.Fatalf("expected %v, got %v", expected, fallbacks)
+	}
+
+	fallbacks, err = CampaignFallbackLanguages(fsys, "generic")
+	if err != nil || fallbacks != nil {
+		t.Fatalf("expected no fallback languages, got %v, %v", fallbacks, err)
+	}
+
+	_, err = CampaignFallbackLanguages(fsys, "empty")
+	if !errors.Is(err, ErrFallbackLanguagesEmpty) {
+		t.Fatalf("expected %v, got %v", ErrFallbackLanguagesEmpty, err)
+	}
+}
+
+func TestOtherLanguages(t *testing.T) {
+	fsys := fstest.MapFS{
+		"faq/languages/en-US.md": {Data: []byte("# FAQ\n")},
+		"faq/languages/nl-NL.md": {Data: []byte("# FAQ\n")},
+		"faq/languages/notes.md": {Data: []byte("Notes\n")},
+	}
+
+	languages, err := otherLanguages(fsys, "faq/languages", "en-US")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TemplateLanguage{{Language: "nl-NL", Name: "Nederlands", URL: "../?lang=nl-NL"}}
+	if !reflect.DeepEqual(languages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, languages)
+	}
+}
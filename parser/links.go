@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+var (
+	ErrLinkBroken    = errors.New("linked file does not exist")
+	ErrLinkNotManual = errors.New("linked markdown file is not a manual")
+)
+
+// Rewrite relative links to markdown files of manuals in doc to the URL the manuals are served at.
+//
+// doc is parsed from the markdown file at filePath in sourceFS, which is written to destFilePath.
+// Links that cannot be resolved are not changed and are added to the build report as warnings.
+func (p *Parser) rewriteLinks(doc ast.Node, sourceFS fs.FS, filePath string, destFilePath string) {
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		link, ok := node.(*ast.Link)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+
+		destination, err := resolveManualLink(sourceFS, filePath, destFilePath, string(link.Destination))
+		if err != nil {
+			p.warn(p.buildError(filePath, StageLinks, fmt.Errorf("%s: %w", link.Destination, err)))
+			return ast.GoToNext
+		}
+
+		if destination != "" {
+			link.Destination = []byte(destination)
+		}
+
+		return ast.GoToNext
+	})
+}
+
+// Resolve destination of a link in the markdown file at filePath in sourceFS,
+// which is written to destFilePath, to the URL of the manual it links to.
+//
+// The URL is relative to the served manual. It is the URL that redirects to the language of the client,
+// unless destination links to another language than the language of the manual at filePath.
+//
+// An empty string is returned if destination is not a relative link to a markdown file.
+func resolveManualLink(sourceFS fs.FS, filePath string, destFilePath string, destination string) (string, error) {
+	linkURL, err := url.Parse(destination)
+	if err != nil || linkURL.Scheme != "" || linkURL.Host != "" || path.IsAbs(linkURL.Path) || path.Ext(linkURL.Path) != ".md" {
+		return "", nil
+	}
+
+	target := path.Join(path.Dir(filePath), linkURL.Path)
+	if !fs.ValidPath(target) || !fileExists(sourceFS, target) {
+		return "", ErrLinkBroken
+	}
+
+	if path.Base(path.Dir(target)) != "languages" {
+		return "", ErrLinkNotManual
+	}
+
+	targetDest, err := GetDestinationFilePath(sourceFS, target)
+	if err != nil {
+		return "", err
+	}
+
+	// Remove languages/<lang>.md.
+	manualDir := path.Dir(path.Dir(targetDest))
+
+	targetLanguage := strings.TrimSuffix(path.Base(target), ".md")
+	if targetLanguage != strings.TrimSuffix(path.Base(filePath), ".md") {
+		manualDir = path.Join(manualDir, targetLanguage)
+	}
+
+	linkURL.Path = relativeDirURL(path.Dir(createDestinationPath(destFilePath)), manualDir)
+	return linkURL.String(), nil
+}
+
+// Return the relative URL of the directory toDir from the directory fromDir, with a trailing slash.
+func relativeDirURL(fromDir string, toDir string) string {
+	from := strings.Split(fromDir, "/")
+	to := strings.Split(toDir, "/")
+
+	common := 0
+	for common < len(from) && common < len(to) && from[common] == to[common] {
+		common++
+	}
+
+	var parts []string
+	for range from[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, to[common:]...)
+
+	if len(parts) == 0 {
+		return "./"
+	}
+
+	return strings.Join(parts, "/") + "/"
+}
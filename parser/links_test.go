@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolveManualLink(t *testing.T) {
+	labFS := newTestLabDirSource(t, map[string]string{
+		"devices/dev1/installation/generic/languages/en-US.md": "# Installation\n",
+		"devices/dev1/faq/generic/languages/en-US.md":          "# FAQ\n",
+		"devices/dev1/faq/generic/languages/nl-NL.md":          "# FAQ\n",
+		"devices/dev1/faq/generic/notes.md":                    "Notes\n",
+	})
+
+	installation := "devices/dev1/installation/generic/languages/en-US.md"
+
+	tests := []struct {
+		name        string
+		destination string
+		expected    string
+		err         error
+	}{
+		{"same language", "../../../faq/generic/languages/en-US.md", "../../../faq/generic/", nil},
+		{"other language", "../../../faq/generic/languages/nl-NL.md#reset", "../../../faq/generic/nl-NL/#reset", nil},
+		{"same manual", "en-US.md", "../", nil},
+		{"not markdown", "../assets/manual.pdf", "", nil},
+		{"website", "https://example.com/readme.md", "", nil},
+		{"anchor", "#reset", "", nil},
+		{"missing", "../../../faq/generic/languages/de-DE.md", "", ErrLinkBroken},
+		{"outside source", "../../../../../../other.md", "", ErrLinkBroken},
+		{"not a manual", "../../../faq/generic/notes.md", "", ErrLinkNotManual},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destination, err := resolveManualLink(labFS, installation, installation, test.destination)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if destination != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, destination)
+			}
+		})
+	}
+
+	repoFS := DeviceRepoSource{&gitRepo{
+		name: "dev1",
+		fsys: fstest.MapFS{
+			"docs/manuals/installation/languages/en-US.md": {Data: []byte("# Installation\n")},
+			"docs/manuals/faq/languages/en-US.md":          {Data: []byte("# FAQ\n")},
+		},
+	}}
+
+	filePath := "docs/manuals/installation/languages/en-US.md"
+	destination, err := resolveManualLink(repoFS, filePath, repoFS.GetDestinationFilePath(filePath), "../../faq/languages/en-US.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "../../../faq/manufacturer/"; destination != expected {
+		t.Fatalf("expected %q, got %q", expected, destination)
+	}
+}
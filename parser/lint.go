@@ -0,0 +1,600 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown/ast"
+	"golang.org/x/text/language"
+)
+
+// Severity of a Problem found by Lint.
+type Severity string
+
+const (
+	// The manual source cannot be parsed correctly.
+	SeverityError Severity = "error"
+	// The manual source can be parsed, but probably not as intended.
+	SeverityWarning Severity = "warning"
+)
+
+// Timeout for checking if a remote image can be downloaded.
+const remoteCheckTimeout = 10 * time.Second
+
+// Matches the line number in a template parse error (e.g. 'template: template.html:12: ...').
+var templateErrorLineRegExp = regexp.MustCompile(`:(\d+):`)
+
+// A Problem is a mistake in a manual source.
+type Problem struct {
+	// Path of the file or directory in the manual source.
+	File string `json:"file"`
+	// Line in the file, or 0 if the problem is not on a specific line.
+	Line     int      `json:"line,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Return the problem as 'file:line: severity: message'.
+func (p Problem) String() string {
+	location := p.File
+	if p.Line > 0 {
+		location += ":" + strconv.Itoa(p.Line)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", location, p.Severity, p.Message)
+}
+
+// Options for Lint.
+type LintOptions struct {
+	// Languages of which every manual and display name should be available in at least one.
+	// A campaign's fallback_languages.json file adds languages for the manuals of the campaign.
+	// It is not checked when there are no fallback languages.
+	FallbackLanguages []language.Tag
+
+	// Check if remote images can be downloaded.
+	CheckRemote bool
+
+	// Markdown extensions enabled when the source has no markdown.json file.
+	Extensions []Extension
+}
+
+// Return if any of problems is an error.
+func HasErrors(problems []Problem) bool {
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Kind of directory in the folder structure specification.
+type dirKind int
+
+const (
+	dirRoot dirKind = iota
+	dirCategory
+	dirEntity
+	dirManualType
+	dirCampaigns
+	dirCampaign
+	dirDocs
+	dirDocsManuals
+	dirManual
+)
+
+type linter struct {
+	fsys    fs.FS
+	options LintOptions
+
+	problems []Problem
+
+	// Markdown extensions enabled for the source.
+	extensions []Extension
+
+	// Results of checking remote images by URL.
+	remote map[string]error
+}
+
+// Check the manual source in sourceFS against the folder structure specification
+// and return every problem that was found, sorted by file and line.
+//
+// Both a lab's manual source and a device firmware repository (with manuals in docs/manuals) can be checked.
+// Device firmware repositories referred to by details.json files are not cloned.
+func Lint(sourceFS fs.FS, options LintOptions) []Problem {
+	l := &linter{
+		fsys:    sourceFS,
+		options: options,
+		remote:  map[string]error{},
+	}
+
+	l.lintMarkdownConfig()
+	l.lintDir(".", dirRoot)
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		if l.problems[i].File != l.problems[j].File {
+			return l.problems[i].File < l.problems[j].File
+		}
+		return l.problems[i].Line < l.problems[j].Line
+	})
+
+	return l.problems
+}
+
+// Add a problem with file at line.
+func (l *linter) report(severity Severity, file string, line int, format string, a ...any) {
+	l.problems = append(l.problems, Problem{
+		File:     file,
+		Line:     line,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Check all entries of the directory at dirPath, which is of kind.
+func (l *linter) lintDir(dirPath string, kind dirKind) {
+	entries, err := fs.ReadDir(l.fsys, dirPath)
+	if err != nil {
+		l.report(SeverityError, dirPath, 0, "%s", err)
+		return
+	}
+
+	var hasLanguages bool
+
+	for _, entry := range entries {
+		fullPath := path.Join(dirPath, entry.Name())
+
+		if strings.HasPrefix(entry.Name(), ".") || isIgnoredFile(entry) {
+			continue
+		}
+
+		if !entry.IsDir() && entry.Name() == htmlTemplateFileName {
+			l.lintTemplate(fullPath)
+			continue
+		}
+
+		switch {
+		case kind == dirRoot && entry.IsDir() && displayNameCategories[entry.Name()]:
+			l.lintDir(fullPath, dirCategory)
+		case kind == dirRoot && entry.IsDir() && entry.Name() == "campaigns":
+			l.lintDir(fullPath, dirCampaigns)
+		case kind == dirRoot && entry.IsDir() && entry.Name() == "docs":
+			l.lintDir(fullPath, dirDocs)
+		case kind == dirRoot && !entry.IsDir() && (entry.Name() == "404.html" || entry.Name() == "error.html"):
+			l.lintTemplate(fullPath)
+		case (kind == dirRoot || kind == dirDocsManuals) && !entry.IsDir() && entry.Name() == MarkdownConfigFileName:
+			// The markdown config is checked before any manual.
+		case (kind == dirRoot || kind == dirCampaign) && !entry.IsDir() && entry.Name() == "contact.json":
+			l.lintContacts(fullPath)
+		case kind == dirCampaign && !entry.IsDir() && entry.Name() == FallbackLanguagesFileName:
+			l.lintFallbackLanguages(fullPath)
+		case kind == dirCategory && entry.IsDir():
+			l.lintDir(fullPath, dirEntity)
+		case kind == dirEntity && isDetailsFile(entry):
+			l.lintDetails(fullPath)
+		case kind == dirEntity && isDisplayNamesFile(entry):
+			l.lintDisplayNames(fullPath)
+		case kind == dirEntity && entry.IsDir():
+			l.lintDir(fullPath, dirManualType)
+		case kind == dirManualType && entry.IsDir() && entry.Name() == "manufacturer":
+			l.report(SeverityError, fullPath, 0, "the campaign name %q is reserved for manuals from device firmware repositories", entry.Name())
+		case kind == dirManualType && entry.IsDir():
+			l.lintDir(fullPath, dirManual)
+		case kind == dirCampaigns && entry.IsDir():
+			l.lintDir(fullPath, dirCampaign)
+		case kind == dirCampaign && entry.IsDir():
+			l.lintDir(fullPath, dirManual)
+		case kind == dirDocs && entry.IsDir() && entry.Name() == "manuals":
+			l.lintDir(fullPath, dirDocsManuals)
+		case kind == dirDocs:
+			// A device firmware repository can contain other documentation.
+		case kind == dirDocsManuals && entry.IsDir():
+			l.lintDir(fullPath, dirManual)
+		case kind == dirManual && entry.IsDir() && entry.Name() == "languages":
+			hasLanguages = true
+			l.lintLanguages(fullPath)
+		case kind == dirManual && isAssetFolder(entry):
+			// Assets are checked when they are used by a manual.
+		case entry.IsDir():
+			l.report(SeverityWarning, fullPath, 0, "unexpected directory, it is not part of the folder structure and will be ignored")
+		default:
+			l.report(SeverityWarning, fullPath, 0, "unexpected file, it is not part of the folder structure and will be ignored")
+		}
+	}
+
+	if kind == dirManual && !hasLanguages {
+		l.report(SeverityError, dirPath, 0, "missing languages directory")
+	}
+}
+
+// Check the markdown files in the languages directory at dirPath.
+func (l *linter) lintLanguages(dirPath string) {
+	entries, err := fs.ReadDir(l.fsys, dirPath)
+	if err != nil {
+		l.report(SeverityError, dirPath, 0, "%s", err)
+		return
+	}
+
+	languages := map[string]bool{}
+
+	for _, entry := range entries {
+		fullPath := path.Join(dirPath, entry.Name())
+
+		if strings.HasPrefix(entry.Name(), ".") || isIgnoredFile(entry) {
+			continue
+		}
+
+		if entry.IsDir() || !isMarkdownFile(entry) {
+			l.report(SeverityWarning, fullPath, 0, "unexpected file, only markdown files named after a language code are parsed")
+			continue
+		}
+
+		lang := strings.TrimSuffix(entry.Name(), ".md")
+		if l.lintLanguageTag(fullPath, 0, lang) {
+			languages[lang] = true
+		}
+
+		l.lintMarkdown(fullPath)
+	}
+
+	// Fallback languages of the campaign are preferred over the other fallback languages.
+	fallbacks, _ := CampaignFallbackLanguages(l.fsys, CampaignFromPath(dirPath))
+	fallbacks = append(fallbacks, l.options.FallbackLanguages...)
+
+	if len(fallbacks) > 0 && len(languages) > 0 && !containsLanguage(languages, fallbacks) {
+		l.report(SeverityWarning, dirPath, 0, "missing manual in fallback language %s", joinLanguages(fallbacks))
+	}
+}
+
+// Check if lang is a valid language code in its canonical form.
+// Returns false and reports a problem at file and line if it is not.
+func (l *linter) lintLanguageTag(file string, line int, lang string) bool {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		l.report(SeverityError, file, line, "invalid language code %q", lang)
+		return false
+	}
+
+	if tag.String() != lang {
+		l.report(SeverityError, file, line, "language code %q should be written as %q", lang, tag.String())
+		return false
+	}
+
+	return true
+}
+
+// Check the markdown file at filePath, including the images and files it links to.
+func (l *linter) lintMarkdown(filePath string) {
+	content, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		l.report(SeverityError, filePath, 0, "%s", err)
+		return
+	}
+
+	_, md, err := parseFrontMatter(content)
+	if err != nil {
+		l.report(SeverityError, filePath, 1, "%s", err)
+	}
+
+	_, err = (&Parser{currentFile: filePath}).findTemplate(l.fsys, filePath)
+	if errors.Is(err, ErrTemplateNotFound) {
+		l.report(SeverityError, filePath, 0, "no %s found in any parent directory and there is no default template", htmlTemplateFileName)
+	}
+
+	doc := parseMarkdown(md, l.extensions)
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+
+		switch node := node.(type) {
+		case *ast.Image:
+			l.lintImage(filePath, content, string(node.Destination))
+		case *ast.Link:
+			l.lintLink(filePath, content, string(node.Destination))
+		}
+
+		return ast.GoToNext
+	})
+}
+
+// Check if the image at destination used by the markdown file at filePath with content exists.
+func (l *linter) lintImage(filePath string, content []byte, destination string) {
+	line := lineOf(content, destination)
+
+	if strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://") {
+		if !l.options.CheckRemote {
+			return
+		}
+
+		err, ok := l.remote[destination]
+		if !ok {
+			err = checkRemote(destination)
+			l.remote[destination] = err
+		}
+		if err != nil {
+			l.report(SeverityError, filePath, line, "image %s could not be downloaded: %s", destination, err)
+		}
+		return
+	}
+
+	if strings.HasPrefix(destination, "data:") {
+		return
+	}
+
+	if !fileExists(l.fsys, path.Join(path.Dir(filePath), destination)) {
+		l.report(SeverityError, filePath, line, "image %s does not exist", destination)
+	}
+}
+
+// Check if the file that destination links to from the markdown file at filePath with content exists.
+// Links to other websites, anchors and absolute paths are not checked.
+func (l *linter) lintLink(filePath string, content []byte, destination string) {
+	linkURL, err := url.Parse(destination)
+	if err != nil {
+		l.report(SeverityError, filePath, lineOf(content, destination), "invalid link %s", destination)
+		return
+	}
+
+	if linkURL.Scheme != "" || linkURL.Host != "" || linkURL.Path == "" || path.IsAbs(linkURL.Path) {
+		return
+	}
+
+	target := path.Join(path.Dir(filePath), linkURL.Path)
+	if !fileExists(l.fsys, target) {
+		l.report(SeverityError, filePath, lineOf(content, destination), "link to %s is broken, the file does not exist", destination)
+		return
+	}
+
+	if path.Ext(target) == ".md" && path.Base(path.Dir(target)) != "languages" {
+		l.report(SeverityWarning, filePath, lineOf(content, destination), "link to %s is not a manual, so it cannot be rewritten to the URL of a manual", destination)
+	}
+}
+
+// Check if the HTML template at filePath can be parsed.
+func (l *linter) lintTemplate(filePath string) {
+	_, err := template.New(path.Base(filePath)).ParseFS(l.fsys, filePath)
+	if err == nil {
+		return
+	}
+
+	var line int
+	match := templateErrorLineRegExp.FindStringSubmatch(err.Error())
+	if match != nil {
+		line, _ = strconv.Atoi(match[1])
+	}
+
+	l.report(SeverityError, filePath, line, "invalid template: %s", err)
+}
+
+// Check the display_names.json file at filePath.
+func (l *linter) lintDisplayNames(filePath string) {
+	data, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		l.report(SeverityError, filePath, 0, "%s", err)
+		return
+	}
+
+	var displayNames map[string]string
+	err = json.Unmarshal(data, &displayNames)
+	if err != nil {
+		l.report(SeverityError, filePath, jsonErrorLine(data, err), "invalid display names: %s", err)
+		return
+	}
+
+	for _, lang := range sortedKeys(displayNames) {
+		line := lineOf(data, `"`+lang+`"`)
+		l.lintLanguageTag(filePath, line, lang)
+
+		if strings.TrimSpace(displayNames[lang]) == "" {
+			l.report(SeverityError, filePath, line, "empty display name for %s", lang)
+		}
+	}
+
+	fallbacks := l.options.FallbackLanguages
+	if len(fallbacks) > 0 && !containsLanguage(displayNames, fallbacks) {
+		l.report(SeverityWarning, filePath, 0, "missing display name in fallback language %s", joinLanguages(fallbacks))
+	}
+}
+
+// Check the details.json file at filePath.
+func (l *linter) lintDetails(filePath string) {
+	data, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		l.report(SeverityError, filePath, 0, "%s", err)
+		return
+	}
+
+	details := struct {
+		Repo string `json:"firmware_repository"`
+		Ref  string `json:"firmware_ref"`
+	}{}
+	err = json.Unmarshal(data, &details)
+	if err != nil {
+		l.report(SeverityError, filePath, jsonErrorLine(data, err), "invalid details: %s", err)
+		return
+	}
+
+	if details.Repo == "" {
+		l.report(SeverityError, filePath, 0, "missing firmware_repository")
+		return
+	}
+
+	line := lineOf(data, details.Repo)
+
+	sourceURL, err := ParseSourceURL(details.Repo)
+	if err != nil {
+		l.report(SeverityError, filePath, line, "invalid firmware_repository: %s", err)
+		return
+	}
+
+	if !sourceURL.IsGit() {
+		l.report(SeverityError, filePath, line, "firmware_repository %s is not a git URL", details.Repo)
+	}
+}
+
+// Check the markdown config file of the source and use its extensions to check manuals.
+func (l *linter) lintMarkdownConfig() {
+	l.extensions = l.options.Extensions
+
+	extensions, filePath, err := readExtensions(l.fsys)
+	if filePath == "" {
+		return
+	}
+
+	if err != nil {
+		data, _ := fs.ReadFile(l.fsys, filePath)
+		l.report(SeverityError, filePath, jsonErrorLine(data, err), "invalid markdown config: %s", err)
+		return
+	}
+
+	l.extensions = extensions
+}
+
+// Check the fallback_languages.json file at filePath.
+func (l *linter) lintFallbackLanguages(filePath string) {
+	data, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		l.report(SeverityError, filePath, 0, "%s", err)
+		return
+	}
+
+	var langs []string
+	err = json.Unmarshal(data, &langs)
+	if err != nil {
+		l.report(SeverityError, filePath, jsonErrorLine(data, err), "invalid fallback languages: %s", err)
+		return
+	}
+
+	if len(langs) == 0 {
+		l.report(SeverityError, filePath, 0, "invalid fallback languages: %s", ErrFallbackLanguagesEmpty)
+	}
+
+	for _, lang := range langs {
+		l.lintLanguageTag(filePath, lineOf(data, `"`+lang+`"`), lang)
+	}
+}
+
+// Check the contact.json file at filePath.
+func (l *linter) lintContacts(filePath string) {
+	data, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		l.report(SeverityError, filePath, 0, "%s", err)
+		return
+	}
+
+	var contacts map[string]json.RawMessage
+	err = json.Unmarshal(data, &contacts)
+	if err != nil {
+		l.report(SeverityError, filePath, jsonErrorLine(data, err), "invalid contact details: %s", err)
+		return
+	}
+
+	for _, lang := range sortedKeys(contacts) {
+		line := lineOf(data, `"`+lang+`"`)
+		l.lintLanguageTag(filePath, line, lang)
+
+		var contact struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+			Phone string `json:"phone"`
+			URL   string `json:"url"`
+			Text  string `json:"text"`
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(contacts[lang]))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&contact)
+		if err != nil {
+			l.report(SeverityError, filePath, line, "invalid contact details for %s: %s", lang, err)
+		}
+	}
+}
+
+// Returns if any of fallbacks is a key of languages.
+func containsLanguage[T any](languages map[string]T, fallbacks []language.Tag) bool {
+	for _, fallback := range fallbacks {
+		if _, ok := languages[fallback.String()]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Join fallbacks for a message (e.g. 'nl-NL or en-US').
+func joinLanguages(fallbacks []language.Tag) string {
+	langs := make([]string, len(fallbacks))
+	for i, fallback := range fallbacks {
+		langs[i] = fallback.String()
+	}
+
+	return strings.Join(langs, " or ")
+}
+
+// Check if the file at rawURL can be downloaded.
+func checkRemote(rawURL string) error {
+	client := http.Client{Timeout: remoteCheckTimeout}
+
+	resp, err := client.Head(rawURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.New(resp.Status)
+	}
+
+	return nil
+}
+
+// Return the line that err occurred on while decoding JSON data, or 0 if it is unknown.
+func jsonErrorLine(data []byte, err error) int {
+	var (
+		syntaxError    *json.SyntaxError
+		unmarshalError *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return lineAt(data, syntaxError.Offset)
+	case errors.As(err, &unmarshalError):
+		return lineAt(data, unmarshalError.Offset)
+	default:
+		return 0
+	}
+}
+
+// Return the line of the first occurrence of s in content, or 0 if content does not contain s.
+func lineOf(content []byte, s string) int {
+	i := bytes.Index(content, []byte(s))
+	if i < 0 {
+		return 0
+	}
+
+	return lineAt(content, int64(i))
+}
+
+// Return the line that offset in content is on.
+func lineAt(content []byte, offset int64) int {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/text/language"
+)
+
+func TestLint(t *testing.T) {
+	sourceFS := fstest.MapFS{
+		"devices/smart-meter/display_names.json":                           {Data: []byte("{\n  \"en_US\": \"Smart meter\"\n}\n")},
+		"devices/smart-meter/details.json":                                 {Data: []byte(`{"firmware_repository": "https://github.com/org/repo"`)},
+		"devices/smart-meter/installation/generic/languages/nl-NL.md":      {Data: []byte("# Installatie\n\n![meter](../assets/meter.png)\n\n[FAQ](../../faq.md)\n")},
+		"devices/smart-meter/installation/generic/assets/meter.png":        {Data: []byte{}},
+		"devices/smart-meter/installation/manufacturer/languages/en-US.md": {Data: []byte("# Installation\n")},
+		"campaigns/generic/faq/languages/en-US.md":                         {Data: []byte("# FAQ\n\n![missing](../assets/missing.png)\n\n[Readme](../../../../README.md)\n")},
+		"campaigns/generic/faq/notes.txt":                                  {Data: []byte{}},
+		"campaigns/dutch/fallback_languages.json":                          {Data: []byte(`["nl-NL", "nl_BE"]`)},
+		"campaigns/dutch/faq/languages/nl-NL.md":                           {Data: []byte("# FAQ\n")},
+		"campaigns/generic/privacy/template.html":                          {Data: []byte("<html>\n{{.Title}\n</html>\n")},
+		"README.md": {Data: []byte{}},
+	}
+
+	expected := []Problem{
+		{File: "campaigns/dutch/fallback_languages.json", Line: 1, Severity: SeverityError, Message: `language code "nl_BE" should be written as "nl-BE"`},
+		{File: "campaigns/generic/faq/languages/en-US.md", Line: 3, Severity: SeverityError, Message: "image ../assets/missing.png does not exist"},
+		{File: "campaigns/generic/faq/languages/en-US.md", Line: 5, Severity: SeverityWarning, Message: "link to ../../../../README.md is not a manual, so it cannot be rewritten to the URL of a manual"},
+		{File: "campaigns/generic/faq/notes.txt", Severity: SeverityWarning, Message: "unexpected file, it is not part of the folder structure and will be ignored"},
+		{File: "campaigns/generic/privacy", Severity: SeverityError, Message: "missing languages directory"},
+		{File: "campaigns/generic/privacy/template.html", Line: 2, Severity: SeverityError, Message: `invalid template: template: template.html:2: bad character U+007D '}'`},
+		{File: "devices/smart-meter/details.json", Line: 1, Severity: SeverityError, Message: "invalid details: unexpected end of JSON input"},
+		{File: "devices/smart-meter/display_names.json", Severity: SeverityWarning, Message: "missing display name in fallback language en-US"},
+		{File: "devices/smart-meter/display_names.json", Line: 2, Severity: SeverityError, Message: `language code "en_US" should be written as "en-US"`},
+		{File: "devices/smart-meter/installation/generic/languages", Severity: SeverityWarning, Message: "missing manual in fallback language en-US"},
+		{File: "devices/smart-meter/installation/generic/languages/nl-NL.md", Line: 5, Severity: SeverityError, Message: "link to ../../faq.md is broken, the file does not exist"},
+		{File: "devices/smart-meter/installation/manufacturer", Severity: SeverityError, Message: `the campaign name "manufacturer" is reserved for manuals from device firmware repositories`},
+	}
+
+	problems := Lint(sourceFS, LintOptions{FallbackLanguages: []language.Tag{language.MustParse("en-US")}})
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", expected, problems)
+	}
+}
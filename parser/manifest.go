@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+)
+
+const (
+	// Name of the file at the root of a generation that lists the content hash of every file in the generation.
+	ManifestFileName = "manifest.json"
+
+	// File in the destination filesystem that keeps the manifest of the last generation,
+	// also between restarts, so files that did not change keep their modification time.
+	manifestCacheFileName = "manifest_cache.json"
+)
+
+// A Manifest lists every file in a generation by path.
+type Manifest map[string]ManifestFile
+
+// A ManifestFile is a file in a Manifest.
+type ManifestFile struct {
+	// SHA-256 hash of the contents, hex encoded.
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+	// Time the contents of the file last changed. It is kept while the hash stays the same,
+	// even though the file is written again for every generation.
+	Modified time.Time `json:"modified"`
+}
+
+// Return a strong entity tag for the contents of f, to use in an ETag header.
+func (f ManifestFile) ETag() string {
+	return `"` + f.Hash + `"`
+}
+
+// Read the manifest of the generation in fsys.
+func ReadManifest(fsys fs.FS) (Manifest, error) {
+	return readManifest(fsys, ManifestFileName)
+}
+
+func readManifest(fsys fs.FS, filePath string) (Manifest, error) {
+	data, err := fs.ReadFile(fsys, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Hash every file in the staging filesystem and write the manifest of the generation.
+//
+// Files that have the same hash as in the manifest of the previous generation keep their modification time.
+// The manifest itself is not listed.
+func (p *Parser) writeManifest() (Manifest, error) {
+	previous, err := readManifest(p.destFS, manifestCacheFileName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	manifest := Manifest{}
+
+	err = fs.WalkDir(p.stagingFS, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		file, err := hashFile(p.stagingFS, filePath)
+		if err != nil {
+			return err
+		}
+
+		file.Modified = now
+		if previousFile, ok := previous[filePath]; ok && previousFile.Hash == file.Hash {
+			file.Modified = previousFile.Modified
+		}
+
+		manifest[filePath] = file
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, wfs.WriteFile(p.stagingFS, ManifestFileName, data, 0644)
+}
+
+// Keep manifest in the destination filesystem, so the next generation can compare its files with it.
+func (p *Parser) cacheManifest(manifest Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	return wfs.WriteFile(p.destFS, manifestCacheFileName, data, 0644)
+}
+
+// Return the hash of data, as it is listed in a manifest.
+func hashData(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Return the hash and size of the file at filePath in fsys.
+func hashFile(fsys fs.FS, filePath string) (ManifestFile, error) {
+	f, err := fsys.Open(filePath)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+
+	return ManifestFile{Hash: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
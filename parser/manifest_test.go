@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+func TestManifest(t *testing.T) {
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/nl-NL.md": "# Veelgestelde vragen\n",
+	})
+
+	destDir := t.TempDir()
+	manualPath := "campaigns/generic/faq/nl-NL/index.html"
+
+	parseManifest := func() Manifest {
+		p := New(dirfs.New(destDir), Options{})
+		err := p.Parse(sourceFS)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		current, err := p.Current()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		manifest, err := ReadManifest(current)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return manifest
+	}
+
+	first := parseManifest()
+
+	file, ok := first[manualPath]
+	if !ok || len(file.Hash) != 64 || file.Size == 0 || file.Modified.IsZero() {
+		t.Fatalf("expected %s in manifest, got %+v", manualPath, first)
+	}
+
+	if _, ok := first[ManifestFileName]; ok {
+		t.Errorf("expected the manifest not to list itself")
+	}
+
+	time.Sleep(time.Second)
+
+	// A new parser for the same destination, like after a restart.
+	second := parseManifest()
+
+	if second[manualPath] != file {
+		t.Errorf("expected unchanged file to keep %+v, got %+v", file, second[manualPath])
+	}
+}
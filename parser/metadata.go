@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+)
+
+// Markers of JPEG segments that are removed by stripJPEGMetadata: APP1 (EXIF and XMP),
+// APP3 to APP13 (e.g. IPTC data), APP15 and comments.
+// APP0 (JFIF), APP2 (ICC color profiles) and APP14 (Adobe color transform) are needed to show the image correctly.
+var jpegMetadataMarkers = map[byte]bool{
+	0xE1: true, 0xE3: true, 0xE4: true, 0xE5: true, 0xE6: true, 0xE7: true, 0xE8: true,
+	0xE9: true, 0xEA: true, 0xEB: true, 0xEC: true, 0xED: true, 0xEF: true, 0xFE: true,
+}
+
+// Types of PNG chunks that are removed by stripPNGMetadata: EXIF data, text and the modification time.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// Remove metadata, such as EXIF data with the GPS coordinates of where a photo was taken,
+// from a JPEG or PNG image with data, without encoding the image again.
+// Other images, and images that cannot be read, are returned as they are.
+//
+// This is used for images that are not processed, because processing them encodes them again,
+// which strips all metadata already.
+func stripImageMetadata(data []byte) []byte {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return stripJPEGMetadata(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	default:
+		return data
+	}
+}
+
+// Remove metadata segments from the JPEG image with data.
+// The EXIF orientation is kept in a new EXIF segment that only contains the orientation,
+// so the image is still shown the right way up.
+func stripJPEGMetadata(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+
+	orientation := jpegOrientation(data)
+
+	stripped := make([]byte, 0, len(data))
+	stripped = append(stripped, data[:2]...)
+
+	for i := 2; i < len(data); {
+		if i+2 > len(data) || data[i] != 0xFF {
+			// Not a valid segment.
+			return data
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte.
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Standalone marker without a length.
+			stripped = append(stripped, data[i:i+2]...)
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			// Start of scan or end of image, the rest is image data.
+			return append(stripped, data[i:]...)
+		}
+
+		if i+4 > len(data) {
+			return data
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return data
+		}
+
+		segment := data[i : i+2+length]
+		i += 2 + length
+
+		if !jpegMetadataMarkers[marker] {
+			stripped = append(stripped, segment...)
+			continue
+		}
+
+		// The orientation takes the place of the EXIF segment.
+		if marker == 0xE1 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) && orientation != 1 {
+			stripped = append(stripped, exifOrientationSegment(orientation)...)
+			orientation = 1
+		}
+	}
+
+	return stripped
+}
+
+// Return a JPEG APP1 segment with EXIF data that only contains orientation.
+func exifOrientationSegment(orientation int) []byte {
+	// Little endian TIFF header with one IFD entry: orientation (0x0112), type short, count 1.
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 1, 0, 0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0, 0, 0, 0, 0}
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(segment) + 2
+
+	return append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, segment...)
+}
+
+// Remove metadata chunks from the PNG image with data.
+func stripPNGMetadata(data []byte) []byte {
+	const signatureLength = 8
+
+	if len(data) < signatureLength {
+		return data
+	}
+
+	stripped := make([]byte, 0, len(data))
+	stripped = append(stripped, data[:signatureLength]...)
+
+	for i := signatureLength; i < len(data); {
+		// Length, type, data and CRC.
+		if i+12 > len(data) {
+			return data
+		}
+
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			return data
+		}
+
+		chunk := data[i : i+12+length]
+		i += 12 + length
+
+		if !pngMetadataChunks[string(chunk[4:8])] {
+			stripped = append(stripped, chunk...)
+		}
+	}
+
+	return stripped
+}
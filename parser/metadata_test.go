@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+// Add segment to the JPEG image with data, right after the start of the image.
+func addJPEGSegment(data []byte, marker byte, payload string) []byte {
+	length := len(payload) + 2
+	segment := append([]byte{0xFF, marker, byte(length >> 8), byte(length)}, payload...)
+
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	for _, orientation := range []byte{1, 6} {
+		data := newTestJPEG(t, 4, 2, orientation)
+		data = addJPEGSegment(data, 0xE1, "http://ns.adobe.com/xap/1.0/\x00<gps>52.22,6.89</gps>")
+		data = addJPEGSegment(data, 0xFE, "taken at home")
+
+		stripped := stripImageMetadata(data)
+
+		for _, metadata := range []string{"gps", "taken at home"} {
+			if bytes.Contains(stripped, []byte(metadata)) {
+				t.Errorf("orientation %d: expected %q to be removed", orientation, metadata)
+			}
+		}
+
+		if bytes.Contains(stripped, []byte("Exif")) != (orientation != 1) {
+			t.Errorf("orientation %d: expected EXIF data only when the image is rotated", orientation)
+		}
+
+		if jpegOrientation(stripped) != int(orientation) {
+			t.Errorf("expected orientation %d to be kept, got %d", orientation, jpegOrientation(stripped))
+		}
+
+		img, _, err := image.Decode(bytes.NewReader(stripped))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 2 {
+			t.Errorf("expected a 4x2 image, got %v", img.Bounds())
+		}
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Metadata chunks are added after the IHDR chunk, which is 8+25 bytes.
+	encoded := buf.Bytes()
+	data := append([]byte{}, encoded[:33]...)
+	data = append(data, newTestPNGChunk("tEXt", []byte("Comment\x00taken at home"))...)
+	data = append(data, newTestPNGChunk("eXIf", []byte("MM\x00\x2a"))...)
+	data = append(data, encoded[33:]...)
+
+	stripped := stripImageMetadata(data)
+	if !bytes.Equal(stripped, encoded) {
+		t.Fatal("expected the tEXt and eXIf chunks to be removed")
+	}
+
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseStripsMetadataWithoutProcessing(t *testing.T) {
+	data := addJPEGSegment(newTestJPEG(t, 4, 2, 1), 0xFE, "taken at home")
+
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/en-US.md": "# FAQ\n\n![photo](../assets/photo.jpg)\n",
+		"campaigns/generic/faq/assets/photo.jpg":   string(data),
+	})
+
+	for _, mode := range []ImageMode{ImageModeFiles, ImageModeInline} {
+		t.Run(string(mode), func(t *testing.T) {
+			// Images are not processed without widths.
+			p := New(dirfs.New(t.TempDir()), Options{
+				ImageMode: mode,
+				Images:    ImageOptions{Widths: []int{}},
+			})
+
+			err := p.Parse(sourceFS)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			current, err := p.Current()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = fs.WalkDir(current, "campaigns", func(filePath string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+
+				content, err := fs.ReadFile(current, filePath)
+				if err != nil {
+					return err
+				}
+
+				// Inlined images are base64 encoded.
+				if strings.Contains(string(content), "taken at home") || strings.Contains(string(content), base64.StdEncoding.EncodeToString(data)) {
+					t.Errorf("expected the metadata to be removed from %s", filePath)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// MultiSource combines the manuals of multiple labs into a single source filesystem.
+//
+// Directories are merged, and a file that is in more than one source is read from the first source that has it.
+type MultiSource struct {
+	sources []fs.FS
+}
+
+// Create a new source filesystem that combines sources, in order of precedence.
+// A single source is returned as it is.
+//
+// A pointer is returned, so the source can be compared with other source filesystems.
+func NewMultiSource(sources ...fs.FS) fs.FS {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+
+	return &MultiSource{sources}
+}
+
+// Return the sources m combines.
+func (m *MultiSource) Sources() []fs.FS {
+	return m.sources
+}
+
+// Open the file at name in the first source that has it.
+func (m *MultiSource) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	for _, source := range m.sources {
+		f, err := source.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return f, err
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Read the directory at name in every source that has it and return the merged entries, sorted by name.
+// An entry that is in more than one source is taken from the first source that has it.
+func (m *MultiSource) ReadDir(name string) ([]fs.DirEntry, error) {
+	var (
+		entries []fs.DirEntry
+		seen    = map[string]bool{}
+		found   bool
+	)
+
+	for _, source := range m.sources {
+		sourceEntries, err := fs.ReadDir(source, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+
+		for _, entry := range sourceEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// Get the path to copy a file to at the destination filesystem.
+// Use filePath at sourceFS to determine the path the file should be copied to at the destination filesystem.
+func (m *MultiSource) GetDestinationFilePath(filePath string) string {
+	return filePath
+}
+
+// Get the path to copy a directory to at the destination filesystem.
+// Use dirPath at sourceFS to determine the path the directory should be copied to at the destination filesystem.
+func (m *MultiSource) GetDestinationDirPath(dirPath string) string {
+	return dirPath
+}
+
+// Watch every source for changes and report them on changed, until ctx is cancelled.
+//
+// Sources that cannot be watched are logged and ignored.
+func (m *MultiSource) Watch(ctx context.Context, pollInterval time.Duration, changed chan<- struct{}) error {
+	g, gCtx := errgroup.WithContext(ctx)
+
+	for _, source := range m.sources {
+		source := source
+		g.Go(func() error {
+			err := Watch(gCtx, source, pollInterval, changed)
+			if errors.Is(err, ErrNotWatchFS) {
+				log.Println("not watching a manual source for changes:", err)
+				return nil
+			}
+			return err
+		})
+	}
+
+	return g.Wait()
+}
+
+// Install the staged updates of every source. Returns if the contents of a source changed.
+func (m *MultiSource) InstallUpdate() (bool, error) {
+	var (
+		installed bool
+		errs      []error
+	)
+
+	for _, source := range m.sources {
+		ok, err := InstallUpdate(source)
+		installed = installed || ok
+		errs = append(errs, err)
+	}
+
+	return installed, errors.Join(errs...)
+}
+
+// Close releases the resources held by every source.
+func (m *MultiSource) Close() error {
+	var errs []error
+	for _, source := range m.sources {
+		errs = append(errs, Close(source))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Return the revisions of the git repositories in source, which can be a MultiSource.
+func sourceRevisions(source fs.FS) []Revision {
+	sources := []fs.FS{source}
+	if m, ok := source.(*MultiSource); ok {
+		sources = m.sources
+	}
+
+	var revisions []Revision
+	for _, source := range sources {
+		revision, err := GetRevision(source)
+		if err == nil {
+			revisions = append(revisions, revision)
+		}
+	}
+
+	return revisions
+}
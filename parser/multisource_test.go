@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+func TestMultiSource(t *testing.T) {
+	first := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/nl-NL.md": "# Veelgestelde vragen\n",
+	})
+	second := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/nl-NL.md":         "# Andere vragen\n",
+		"campaigns/generic/faq/languages/en-US.md":         "# Frequently asked questions\n",
+		"campaigns/winter/installation/languages/en-US.md": "# Installation\n",
+	})
+
+	sourceFS := NewMultiSource(first, second)
+
+	entries, err := fs.ReadDir(sourceFS, "campaigns/generic/faq/languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].Name() != "en-US.md" || entries[1].Name() != "nl-NL.md" {
+		t.Fatalf("expected the merged languages en-US.md and nl-NL.md, got %v", entries)
+	}
+
+	p := New(dirfs.New(t.TempDir()), Options{})
+	err = p.Parse(sourceFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := p.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, manualPath := range []string{
+		"campaigns/generic/faq/en-US/index.html",
+		"campaigns/winter/installation/en-US/index.html",
+	} {
+		if _, err := fs.Stat(current, manualPath); err != nil {
+			t.Errorf("expected %s from the second source: %v", manualPath, err)
+		}
+	}
+
+	data, err := fs.ReadFile(current, "campaigns/generic/faq/nl-NL/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "Veelgestelde vragen") {
+		t.Errorf("expected the manual from the first source to win")
+	}
+}
+
+func TestMultiSourceMixed(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	local := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/nl-NL.md": "# Veelgestelde vragen\n",
+	})
+
+	repoDir := t.TempDir()
+	manual := filepath.Join(repoDir, "campaigns", "winter", "installation", "languages", "en-US.md")
+
+	err := os.MkdirAll(filepath.Dir(manual), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(manual, []byte("# Installation\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, repoDir, "init", "-q", "-b", "main")
+	runGit(t, repoDir, "add", "-A")
+	runGit(t, repoDir, "commit", "-q", "-m", "installation")
+
+	repo, err := NewLabRepoSource("file://"+filepath.ToSlash(repoDir), "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sourceFS := NewMultiSource(local, repo)
+	defer Close(sourceFS)
+
+	p := New(dirfs.New(t.TempDir()), Options{})
+	err = p.Parse(sourceFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := p.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, manualPath := range []string{
+		"campaigns/generic/faq/nl-NL/index.html",
+		"campaigns/winter/installation/en-US/index.html",
+	} {
+		if _, err := fs.Stat(current, manualPath); err != nil {
+			t.Errorf("expected %s: %v", manualPath, err)
+		}
+	}
+
+	data, err := fs.ReadFile(current, RevisionsFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), "file://") {
+		t.Errorf("expected the revision of the git repository, got %s", data)
+	}
+}
@@ -3,6 +3,7 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,27 +12,33 @@ import (
 	"io"
 	"io/fs"
 	"log"
-	"net/http"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/energietransitie/needforheat-manual-server/defaults"
 	"github.com/energietransitie/needforheat-manual-server/wfs"
-	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/ast"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
 )
 
 const (
 	htmlTemplateFileName = "template.html"
 	fallbackManualTitle  = "NeedForHeat manual"
+
+	// Name of the file at the root of a generation that lists the revisions of git repositories it was parsed from.
+	RevisionsFileName = "revisions.json"
+)
+
+const (
+	stagingDirPattern   = "staging_*"
+	generationDirFormat = "generation_%d"
 )
 
 var (
 	ErrTemplateNotFound = errors.New("template file could not be found")
 	ErrCategoryUnknown  = errors.New("file has no default template")
+	ErrNoGeneration     = errors.New("parser: no generation has been parsed")
 )
 
 // ManualCategory is the type of manual.
@@ -46,23 +53,112 @@ type HTMLTemplate struct {
 	Language string
 	Title    string
 	Body     template.HTML
+
+	// Metadata from the front matter of the manual.
+	Description  string
+	LastReviewed time.Time
+	Author       string
+	Version      string
+	Keywords     []string
+
+	// Front matter fields that have no field of their own, by name.
+	Meta map[string]any
+
+	// Headings of the manual. Use {{.TOC.HTML}} to render it as nested lists of links.
+	TOC TableOfContents
+
+	// Other languages the manual is available in, to render a language switcher.
+	Languages []TemplateLanguage
+}
+
+// Options for a Parser.
+type Options struct {
+	// Credentials used to clone device firmware repositories.
+	// When nil, repositories are cloned without authentication.
+	Credentials *Credentials
+
+	// ImageMode sets how images are included in manuals. Images are inlined when it is empty.
+	ImageMode ImageMode
+
+	// Images sets how JPEG and PNG images are processed.
+	Images ImageOptions
+
+	// Remote sets how remote images are downloaded.
+	Remote FetchOptions
+
+	// Extensions of the markdown syntax that are enabled for sources without a markdown.json file.
+	// See [Extension].
+	Extensions []Extension
+
+	// Compression sets how generated text files are precompressed.
+	Compression CompressionOptions
+
+	// Resilient makes the parser skip files that cannot be parsed, instead of stopping at the first error.
+	// Skipped files are listed in the build report. See [Parser.Report].
+	Resilient bool
 }
 
 // A Parser can parse manuals written in markdown to html files.
 //
 // Following the folder structure specification, the parser will parse all markdown files to HTML
 // while checking languages and creating a structure that can be served by a [Server].
+//
+// Every time manuals are parsed, a new generation of the structure is created in the destination filesystem.
+// The current generation and the one before it are kept, so a [Server] can keep serving a generation
+// while the next one is being parsed. A Parser is not safe for concurrent use.
 type Parser struct {
-	destFS fs.FS
+	destFS  fs.FS
+	options Options
+
+	// Filesystem the generation that is being parsed is written to.
+	stagingFS fs.FS
+
+	// Number of generations parsed so far.
+	generations int
+
+	// Names of the directories in destFS containing the current and previous generation.
+	current  string
+	previous string
+
+	// Revisions of the git repositories the generation that is being parsed is parsed from.
+	revisions []Revision
+
+	// Source of the lab that is being parsed, which contains display names for all manuals.
+	labFS fs.FS
+
+	// Catalog of the generation that is being parsed.
+	catalog *catalogBuilder
+
+	// Search indexes of the generation that is being parsed.
+	search *searchIndexBuilder
 
 	// Temporarily store the current filePath being parsed.
 	currentFile string
+
+	// URL of the git repository that is being parsed, if it is not the lab's source.
+	currentSource string
+
+	// Markdown extensions enabled for the source that is being parsed.
+	extensions []Extension
+
+	// Report of the last time manuals were parsed.
+	report BuildReport
+
+	// Keys of cached processed images used by the generation that is being parsed.
+	usedImages map[string]bool
+
+	// Downloads remote images.
+	fetcher *remoteFetcher
 }
 
-// Create a new Parser that uses sourceFS as its filesystem to parse manuals.
-func New(destFS fs.FS) *Parser {
+// Create a new Parser that uses destFS as its filesystem to write parsed manuals to.
+//
+// Everything in destFS is erased, except cached images and the manifest of the last generation.
+func New(destFS fs.FS, options Options) *Parser {
 	parser := &Parser{
-		destFS: destFS,
+		destFS:  destFS,
+		options: options,
+		fetcher: newRemoteFetcher(destFS, options.Remote),
 	}
 
 	parser.eraseDest()
@@ -72,13 +168,178 @@ func New(destFS fs.FS) *Parser {
 // Parse files following the folder structure specification
 // to a filesystem that a [Server] can use to serve HTML.
 //
+// Staged updates of sourceFS are installed first, see [UpdateFS].
+//
+// The files are parsed to a staging directory in destFS, which only becomes
+// the current generation when parsing succeeded. Use [Parser.Current] to get it.
+//
 // destFS has to be a writable filessytem.
 func (p *Parser) Parse(sourceFS fs.FS) error {
+	// Updates that were fetched while watching the source are installed before it is read,
+	// so the contents do not change while they are parsed.
+	_, err := InstallUpdate(sourceFS)
+	if err != nil {
+		log.Println("error removing previous version of manual source:", err)
+	}
+
+	stagingDir, err := wfs.MkdirTemp(p.destFS, ".", stagingDirPattern)
+	if err != nil {
+		return err
+	}
+
+	p.stagingFS, err = fs.Sub(p.destFS, stagingDir)
+	if err != nil {
+		return err
+	}
+	p.labFS = sourceFS
+	p.catalog = newCatalogBuilder()
+	p.search = newSearchIndexBuilder()
+	p.report = BuildReport{
+		Started:  time.Now(),
+		Errors:   []*BuildError{},
+		Warnings: []*BuildError{},
+	}
+	p.usedImages = map[string]bool{}
+	p.fetcher.used = map[string]bool{}
+
+	defer func() {
+		p.stagingFS = nil
+		p.revisions = nil
+		p.labFS = nil
+		p.catalog = nil
+		p.search = nil
+		p.usedImages = nil
+		p.fetcher.used = nil
+	}()
+
+	err = p.parse(sourceFS)
+	p.report.Finished = time.Now()
+	if err == nil {
+		p.report.Log()
+		err = p.writeReport()
+	}
+	if err == nil {
+		err = p.writeRevisions()
+	}
+	if err == nil {
+		err = p.writeCatalog()
+	}
+	if err == nil {
+		err = p.writeSearchIndexes()
+	}
+	if err == nil {
+		err = p.compressFiles()
+	}
+	var manifest Manifest
+	if err == nil {
+		// The manifest is written last, so it lists every file of the generation.
+		manifest, err = p.writeManifest()
+	}
+	if err != nil {
+		wfs.RemoveAll(p.destFS, stagingDir)
+		return err
+	}
+
+	generationDir := fmt.Sprintf(generationDirFormat, p.generations+1)
+
+	err = wfs.Rename(p.destFS, stagingDir, generationDir)
+	if err != nil {
+		wfs.RemoveAll(p.destFS, stagingDir)
+		return err
+	}
+
+	p.generations++
+
+	if p.previous != "" {
+		err = wfs.RemoveAll(p.destFS, p.previous)
+		if err != nil {
+			log.Println("error removing generation", p.previous+":", err)
+		}
+	}
+
+	p.previous = p.current
+	p.current = generationDir
+
+	err = p.cacheManifest(manifest)
+	if err != nil {
+		log.Println("error caching manifest:", err)
+	}
+
+	err = p.pruneImageCache()
+	if err != nil {
+		log.Println("error pruning image cache:", err)
+	}
+
+	err = p.fetcher.pruneCache()
+	if err != nil {
+		log.Println("error pruning remote image cache:", err)
+	}
+
+	return nil
+}
+
+// Return the filesystem containing the current generation of parsed manuals.
+func (p *Parser) Current() (fs.FS, error) {
+	if p.current == "" {
+		return nil, ErrNoGeneration
+	}
+
+	return fs.Sub(p.destFS, p.current)
+}
+
+// Return the report of the last time manuals were parsed, including the files that were skipped.
+func (p *Parser) Report() BuildReport {
+	return p.report
+}
+
+// Make the previous generation of parsed manuals the current generation again
+// and return its filesystem.
+//
+// The generation that was current is removed.
+func (p *Parser) Rollback() (fs.FS, error) {
+	if p.previous == "" {
+		return nil, ErrNoGeneration
+	}
+
+	err := wfs.RemoveAll(p.destFS, p.current)
+	if err != nil {
+		return nil, err
+	}
+
+	p.current = p.previous
+	p.previous = ""
+
+	return p.Current()
+}
+
+// Parse files in sourceFS to the staging filesystem.
+func (p *Parser) parse(sourceFS fs.FS) error {
 	if sourceFS == nil {
 		return nil
 	}
 
-	err := p.parseRecursive(sourceFS, ".")
+	previousSource, previousExtensions := p.currentSource, p.extensions
+	defer func() {
+		p.currentSource, p.extensions = previousSource, previousExtensions
+	}()
+
+	revisions := sourceRevisions(sourceFS)
+	p.revisions = append(p.revisions, revisions...)
+	if len(revisions) == 1 && sourceFS != p.labFS {
+		p.currentSource = revisions[0].URL
+	}
+
+	p.extensions = p.options.Extensions
+	extensions, configPath, err := readExtensions(sourceFS)
+	if configPath != "" {
+		err = p.skip(p.buildError(configPath, StageMarkdownConf, err))
+		if err != nil {
+			return err
+		}
+		p.extensions = extensions
+	}
+
+	err = p.parseRecursive(sourceFS, ".")
 	if err != nil {
 		return err
 	}
@@ -86,9 +347,43 @@ func (p *Parser) Parse(sourceFS fs.FS) error {
 	return nil
 }
 
-// Erase the destination filesystem.
+// Write the revisions of the git repositories that were parsed to the staging filesystem.
+func (p *Parser) writeRevisions() error {
+	revisions := p.revisions
+	if revisions == nil {
+		revisions = []Revision{}
+	}
+
+	data, err := json.MarshalIndent(revisions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return wfs.WriteFile(p.stagingFS, RevisionsFileName, data, 0644)
+}
+
+// Erase everything in the destination filesystem, except cached images.
 func (p *Parser) eraseDest() error {
-	return wfs.RemoveAll(p.destFS, ".")
+	entries, err := fs.ReadDir(p.destFS, ".")
+	if errors.Is(err, fs.ErrNotExist) {
+		return wfs.MkdirAll(p.destFS, ".", fs.ModePerm)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == imageCacheDir || entry.Name() == remoteCacheDir || entry.Name() == manifestCacheFileName {
+			continue
+		}
+
+		err = wfs.RemoveAll(p.destFS, entry.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Parse the source folder recursively and process each file or folder appropriately.
@@ -103,30 +398,22 @@ func (p *Parser) parseRecursive(sourceFS fs.FS, pathName string) error {
 		if isIgnoredFile(entry) {
 			continue
 		} else if isMarkdownFile(entry) {
-			err = p.parseMdToHTML(sourceFS, fullPath)
-			if err != nil {
-				return err
-			}
+			err = p.skip(p.parseMdToHTML(sourceFS, fullPath))
 		} else if isDetailsFile(entry) {
-			err = p.getRepoManual(sourceFS, fullPath)
-			if err != nil {
-				return err
-			}
+			err = p.skip(p.getRepoManual(sourceFS, fullPath))
 		} else if isDisplayNamesFile(entry) {
-			err = p.copyFileToDest(sourceFS, fullPath)
-			if err != nil {
-				return err
-			}
+			err = p.skip(p.parseDisplayNames(sourceFS, fullPath))
+		} else if isErrorPageFile(fullPath) {
+			err = p.skip(p.copyFileToDest(sourceFS, fullPath))
+		} else if isFallbackLanguagesFile(fullPath) {
+			err = p.skip(p.copyFallbackLanguages(sourceFS, fullPath))
 		} else if isAssetFolder(entry) {
 			err = p.copyDirToDest(sourceFS, fullPath)
-			if err != nil {
-				return err
-			}
 		} else if entry.IsDir() {
 			err = p.parseRecursive(sourceFS, fullPath)
-			if err != nil {
-				return err
-			}
+		}
+		if err != nil {
+			return err
 		}
 	}
 
@@ -141,77 +428,140 @@ func (p *Parser) parseRecursive(sourceFS fs.FS, pathName string) error {
 func (p *Parser) parseMdToHTML(sourceFS fs.FS, filePath string) error {
 	md, err := fs.ReadFile(sourceFS, filePath)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageRead, err)
 	}
 
 	p.currentFile = filePath
 
-	mdParser := parser.NewWithExtensions(parser.CommonExtensions)
-	doc := mdParser.Parse(md)
+	frontMatter, md, err := parseFrontMatter(md)
+	if err != nil {
+		return p.buildError(filePath, StageFrontMatter, err)
+	}
 
-	doc = base64EncodeImages(doc, sourceFS, filePath)
+	doc := parseMarkdown(md, p.extensions)
+	toc := newTableOfContents(doc)
 
-	htmlRenderer := html.NewRenderer(html.RendererOptions{Flags: html.CommonFlags})
+	destFilePath, err := GetDestinationFilePath(sourceFS, filePath)
+	if err != nil {
+		return p.buildError(filePath, StageWrite, err)
+	}
+
+	doc, err = p.includeImages(doc, sourceFS, filePath, destFilePath)
+	if err != nil {
+		return p.buildError(filePath, StageImages, err)
+	}
+
+	p.rewriteLinks(doc, sourceFS, filePath, destFilePath)
 
-	renderedHTML := markdown.Render(doc, htmlRenderer)
+	renderedHTML := renderMarkdown(doc, toc)
 
 	t, err := p.findTemplate(sourceFS, filePath)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageTemplate, err)
 	}
 
-	destFilePath, err := GetDestinationFilePath(sourceFS, filePath)
+	language := strings.TrimSuffix(path.Base(filePath), ".md")
+	title, ok := frontMatter.Title, frontMatter.Title != ""
+	if !ok {
+		title, ok = findTitle(md)
+	}
+	if !ok {
+		title, ok = displayNameTitle(p.labFS, destFilePath, language)
+	}
+	if !ok {
+		title = fallbackManualTitle
+	}
+
+	languages, err := otherLanguages(sourceFS, path.Dir(filePath), language)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageRead, err)
+	}
+
+	templateData := HTMLTemplate{
+		Language:     language,
+		Title:        title,
+		Body:         template.HTML(renderedHTML),
+		Description:  frontMatter.Description,
+		LastReviewed: frontMatter.LastReviewed,
+		Author:       frontMatter.Author,
+		Version:      frontMatter.Version,
+		Keywords:     frontMatter.Keywords,
+		Meta:         frontMatter.Extra,
+		TOC:          toc,
+		Languages:    languages,
+	}
+
+	// Render to a buffer first, so nothing is written for a manual that fails.
+	var buf bytes.Buffer
+	err = t.Execute(&buf, templateData)
+	if err != nil {
+		return p.buildError(filePath, StageRender, err)
 	}
 
 	destinationHTMLPath := createDestinationPath(destFilePath)
 
-	err = wfs.MkdirAll(p.destFS, path.Dir(destinationHTMLPath), fs.ModePerm)
+	err = wfs.MkdirAll(p.stagingFS, path.Dir(destinationHTMLPath), fs.ModePerm)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageWrite, err)
 	}
 
-	file, err := wfs.CreateFile(p.destFS, destinationHTMLPath)
+	err = wfs.WriteFile(p.stagingFS, destinationHTMLPath, buf.Bytes(), 0644)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageWrite, err)
 	}
-	defer file.Close()
 
-	language := strings.TrimSuffix(path.Base(filePath), ".md")
-	title := findTitle(md)
+	p.catalog.addManual(destFilePath, language, title)
+	p.search.addManual(destFilePath, language, title, doc, toc)
+	p.report.Manuals++
+	return nil
+}
 
-	templateData := HTMLTemplate{
-		Language: language,
-		Title:    title,
-		Body:     template.HTML(renderedHTML),
+// Add the display names in the display_names.json file at filePath to the catalog
+// and copy the file to p.stagingFS.
+func (p *Parser) parseDisplayNames(sourceFS fs.FS, filePath string) error {
+	displayNames, err := readDisplayNames(sourceFS, filePath)
+	if err != nil {
+		return p.buildError(filePath, StageDisplayNames, err)
 	}
 
-	return t.Execute(file, templateData)
+	destFilePath, err := GetDestinationFilePath(sourceFS, filePath)
+	if err != nil {
+		return p.buildError(filePath, StageDisplayNames, err)
+	}
+
+	p.catalog.addDisplayNames(destFilePath, displayNames)
+
+	return p.copyFileToDest(sourceFS, filePath)
 }
 
 // Get the repo manuals for the device based on details.json file at filePath.
 func (p *Parser) getRepoManual(sourceFS fs.FS, filePath string) error {
 	file, err := fs.ReadFile(sourceFS, filePath)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageDeviceRepo, err)
 	}
 
 	details := struct {
 		Repo string `json:"firmware_repository"`
+		Ref  string `json:"firmware_ref"`
 	}{}
 	err = json.Unmarshal(file, &details)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageDeviceRepo, err)
 	}
 
-	// TODO: possibly support authentication.
-	deviceRepo, err := NewDeviceRepoSource(details.Repo, nil)
+	auth, err := p.options.Credentials.AuthMethod(details.Repo)
 	if err != nil {
-		return err
+		return p.buildError(filePath, StageDeviceRepo, err)
 	}
 
-	return p.Parse(deviceRepo)
+	deviceRepo, err := NewDeviceRepoSource(details.Repo, details.Ref, auth)
+	if err != nil {
+		return p.buildError(filePath, StageDeviceRepo, err)
+	}
+	defer Close(deviceRepo)
+
+	return p.parse(deviceRepo)
 }
 
 // Return the template that should be used for the file at the specified filePath.
@@ -236,8 +586,16 @@ func (p *Parser) findTemplate(sourceFS fs.FS, filePath string) (*template.Templa
 	return template.New(htmlTemplateFileName).ParseFS(sourceFS, testFilePath)
 }
 
-// Copy file at filePath from p.sourceFS to p.destFS.
+// Copy file at filePath from sourceFS to p.stagingFS.
 func (p *Parser) copyFileToDest(sourceFS fs.FS, filePath string) error {
+	return p.buildError(filePath, StageCopy, p.copyFile(sourceFS, filePath))
+}
+
+func (p *Parser) copyFile(sourceFS fs.FS, filePath string) error {
+	if isProcessableImage(path.Ext(filePath)) {
+		return p.copyImage(sourceFS, filePath)
+	}
+
 	sourceFile, err := sourceFS.Open(filePath)
 	if err != nil {
 		return err
@@ -249,17 +607,17 @@ func (p *Parser) copyFileToDest(sourceFS fs.FS, filePath string) error {
 		return err
 	}
 
-	destFile, err := wfs.CreateFile(p.destFS, destFilePath)
+	destFile, err := wfs.CreateFile(p.stagingFS, destFilePath)
 	if errors.Is(err, fs.ErrNotExist) {
 		info, err := fs.Stat(sourceFS, path.Dir(filePath))
 		if err != nil {
 			return err
 		}
-		err = wfs.MkdirAll(p.destFS, path.Dir(destFilePath), info.Mode())
+		err = wfs.MkdirAll(p.stagingFS, path.Dir(destFilePath), info.Mode())
 		if err != nil {
 			return err
 		}
-		destFile, err = wfs.CreateFile(p.destFS, destFilePath)
+		destFile, err = wfs.CreateFile(p.stagingFS, destFilePath)
 		if err != nil {
 			return err
 		}
@@ -273,20 +631,56 @@ func (p *Parser) copyFileToDest(sourceFS fs.FS, filePath string) error {
 	return err
 }
 
-// Copy dir at path from p.sourceFS to p.destFS.
+// Copy the image at filePath from sourceFS to p.stagingFS, with its metadata stripped.
+// The image is processed if images are processed, and else only its metadata is removed.
+func (p *Parser) copyImage(sourceFS fs.FS, filePath string) error {
+	data, err := fs.ReadFile(sourceFS, filePath)
+	if err != nil {
+		return err
+	}
+
+	data = stripImageMetadata(data)
+
+	if p.processImages() {
+		set, err := p.processImage(data, false, false)
+		if err == nil {
+			data, err = p.readProcessedImage(set, set.Full)
+		}
+		if err != nil && !p.skipImageProcessing(filePath, filePath, err) {
+			return err
+		}
+	}
+
+	destFilePath, err := GetDestinationFilePath(sourceFS, filePath)
+	if err != nil {
+		return err
+	}
+
+	err = wfs.MkdirAll(p.stagingFS, path.Dir(destFilePath), fs.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return wfs.WriteFile(p.stagingFS, destFilePath, data, 0644)
+}
+
+// Copy dir at path from sourceFS to p.stagingFS.
 func (p *Parser) copyDirToDest(sourceFS fs.FS, dirPath string) error {
 	entries, err := fs.ReadDir(sourceFS, dirPath)
 	if err != nil {
-		return err
+		return p.skip(p.buildError(dirPath, StageCopy, err))
 	}
 
 	for _, entry := range entries {
 		fullPath := path.Join(dirPath, entry.Name())
 
 		if entry.IsDir() {
-			p.copyDirToDest(sourceFS, fullPath)
+			err = p.copyDirToDest(sourceFS, fullPath)
 		} else {
-			p.copyFileToDest(sourceFS, fullPath)
+			err = p.skip(p.copyFileToDest(sourceFS, fullPath))
+		}
+		if err != nil {
+			return err
 		}
 	}
 
@@ -309,59 +703,72 @@ func (p *Parser) findDefaultTemplate() (string, error) {
 // Find the title of a markdown file.
 //
 // input is the bytes read from a markdown file.
-// If a title could not be found, a fallback will be used.
-func findTitle(input []byte) string {
+// Returns false if the markdown file does not start with a title.
+func findTitle(input []byte) (string, bool) {
 	// We only need to replace the first occurance, so use Replace, instead of ReplaceAll.
 	osIndependentInputString := strings.Replace(string(input), "\r\n", "\n", 1)
 	lines := strings.Split(osIndependentInputString, "\n")
 	if len(lines) <= 0 {
-		return fallbackManualTitle
+		return "", false
 	}
 
 	title, ok := strings.CutPrefix(lines[0], "# ")
 	if ok {
-		return strings.TrimSpace(title)
+		return strings.TrimSpace(title), true
 	}
-	return fallbackManualTitle
+	return "", false
 }
 
 // Find all images and embed them into the src as base64, instead of a (relative) link.
-func base64EncodeImages(doc ast.Node, fsys fs.FS, mdFilepath string) ast.Node {
-	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
-		if img, ok := node.(*ast.Image); ok && entering {
-			imageExtension := path.Ext(string(img.Destination))
-			imageExtension = strings.TrimPrefix(imageExtension, ".")
+//
+// Remote images that cannot be downloaded keep their URL.
+// An error is returned for the first other image that could not be read.
+func (p *Parser) base64EncodeImages(doc ast.Node, fsys fs.FS, mdFilepath string) (ast.Node, error) {
+	var imageErr error
 
-			imageData, err := readImage(string(img.Destination), fsys, mdFilepath)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if img, ok := node.(*ast.Image); ok && entering && !strings.HasPrefix(string(img.Destination), "data:") {
+			imageData, err := p.readImage(string(img.Destination), fsys, mdFilepath)
+			if p.keepRemoteImage(string(img.Destination), mdFilepath, err) {
+				return ast.GoToNext
+			}
 			if err != nil {
-				log.Println("error reading image:", err)
+				imageErr = fmt.Errorf("error reading image %s: %w", img.Destination, err)
 				return ast.Terminate
 			}
 
+			imageData = stripImageMetadata(imageData)
+			contentType := sniffImageType(imageData, string(img.Destination))
+
+			if p.processImages() && isProcessableImageData(imageData) {
+				processedData, imageExtension, err := p.inlineProcessedImage(imageData)
+				if err == nil {
+					imageData = processedData
+					contentType = "image/" + imageExtension
+				} else if !p.skipImageProcessing(string(img.Destination), mdFilepath, err) {
+					imageErr = fmt.Errorf("error processing image %s: %w", img.Destination, err)
+					return ast.Terminate
+				}
+			}
+
 			base64Image := base64.StdEncoding.EncodeToString(imageData)
 
-			src := "data:image/" + imageExtension + ";base64," + base64Image
+			src := "data:" + contentType + ";base64," + base64Image
 
 			img.Destination = []byte(src)
 		}
 
 		return ast.GoToNext
 	})
-	return doc
+	return doc, imageErr
 }
 
 // Read image data from a source.
 // Returns the bytes.
-func readImage(source string, fsys fs.FS, mdFilepath string) ([]byte, error) {
-	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+func (p *Parser) readImage(source string, fsys fs.FS, mdFilepath string) ([]byte, error) {
+	if isRemote(source) {
 		// Image has to be downloaded first.
-		resp, err := http.Get(source)
-		if err != nil {
-			return []byte{}, err
-		}
-
-		defer resp.Body.Close()
-		return io.ReadAll(resp.Body)
+		return p.fetcher.fetch(source)
 	} else {
 		relativePath := path.Join(path.Dir(mdFilepath), source)
 		return fs.ReadFile(fsys, relativePath)
@@ -390,7 +797,19 @@ func isMarkdownFile(d fs.DirEntry) bool {
 }
 
 func isDisplayNamesFile(d fs.DirEntry) bool {
-	return !d.IsDir() && d.Name() == "display_names.json"
+	return !d.IsDir() && d.Name() == displayNamesFileName
+}
+
+// Returns if the file at filePath is used to show error pages.
+// These are 404.html, error.html and contact.json at the root, and contact.json for a campaign.
+func isErrorPageFile(filePath string) bool {
+	switch filePath {
+	case "404.html", "error.html", "contact.json":
+		return true
+	}
+
+	matched, _ := path.Match("campaigns/*/contact.json", filePath)
+	return matched
 }
 
 func isDetailsFile(d fs.DirEntry) bool {
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+)
+
+const (
+	// Name of the file at the root of a generation that contains the report of parsing it.
+	BuildReportFileName = "build_report.json"
+)
+
+// Stage of parsing a file in which a BuildError occurred.
+type Stage string
+
+const (
+	StageRead         Stage = "read"
+	StageFrontMatter  Stage = "front_matter"
+	StageImages       Stage = "images"
+	StageTemplate     Stage = "template"
+	StageRender       Stage = "render"
+	StageWrite        Stage = "write"
+	StageDisplayNames Stage = "display_names"
+	StageDeviceRepo   Stage = "device_repository"
+	StageCopy         Stage = "copy"
+	StageMarkdownConf Stage = "markdown_config"
+	StageLinks        Stage = "links"
+	StageFallbacks    Stage = "fallback_languages"
+)
+
+// A BuildError is an error that occurred while parsing a file in a manual source.
+type BuildError struct {
+	// URL of the git repository the file is in, if it is not in the lab's manual source.
+	Source string
+	// Path of the file in its source.
+	File  string
+	Stage Stage
+	Err   error
+}
+
+func (e *BuildError) Error() string {
+	file := e.File
+	if e.Source != "" {
+		file = e.Source + ": " + file
+	}
+
+	return fmt.Sprintf("%s: %s: %s", file, e.Stage, e.Err)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BuildError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Source string `json:"source,omitempty"`
+		File   string `json:"file"`
+		Stage  Stage  `json:"stage"`
+		Error  string `json:"error"`
+	}{
+		Source: e.Source,
+		File:   e.File,
+		Stage:  e.Stage,
+		Error:  e.Err.Error(),
+	})
+}
+
+// A BuildReport summarises parsing a manual source.
+type BuildReport struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	// Number of manuals that were parsed successfully.
+	Manuals int `json:"manuals"`
+
+	// Errors of files that were skipped.
+	Errors []*BuildError `json:"errors"`
+
+	// Problems in files that were parsed anyway, such as links that could not be resolved.
+	Warnings []*BuildError `json:"warnings"`
+}
+
+// Log a summary of the report, followed by every error and warning.
+func (r BuildReport) Log() {
+	log.Printf("parsed %d manuals with %d errors and %d warnings in %s", r.Manuals, len(r.Errors), len(r.Warnings), r.Finished.Sub(r.Started).Round(time.Millisecond))
+
+	for _, err := range r.Errors {
+		log.Println("skipped", err)
+	}
+
+	for _, err := range r.Warnings {
+		log.Println("warning", err)
+	}
+}
+
+// Create a BuildError for the file at filePath in the source that is being parsed.
+// Returns nil if err is nil.
+func (p *Parser) buildError(filePath string, stage Stage, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &BuildError{
+		Source: p.currentSource,
+		File:   filePath,
+		Stage:  stage,
+		Err:    err,
+	}
+}
+
+// Handle err that occurred while parsing a file.
+//
+// When the parser is resilient, err is added to the report and nil is returned,
+// so the file is skipped and parsing continues. Otherwise, err is returned.
+func (p *Parser) skip(err error) error {
+	if err == nil || !p.options.Resilient {
+		return err
+	}
+
+	buildErr, ok := err.(*BuildError)
+	if !ok {
+		buildErr = &BuildError{Source: p.currentSource, File: p.currentFile, Err: err}
+	}
+
+	p.report.Errors = append(p.report.Errors, buildErr)
+	return nil
+}
+
+// Add err to the warnings in the report. Parsing continues, whether the parser is resilient or not.
+func (p *Parser) warn(err error) {
+	if err == nil {
+		return
+	}
+
+	buildErr, ok := err.(*BuildError)
+	if !ok {
+		buildErr = &BuildError{Source: p.currentSource, File: p.currentFile, Err: err}
+	}
+
+	p.report.Warnings = append(p.report.Warnings, buildErr)
+}
+
+// Write the report to the staging filesystem.
+func (p *Parser) writeReport() error {
+	data, err := json.MarshalIndent(p.report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return wfs.WriteFile(p.stagingFS, BuildReportFileName, data, 0644)
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestParseResilient(t *testing.T) {
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/en-US.md":     "# FAQ\n",
+		"campaigns/generic/privacy/languages/en-US.md": "---\ntitle: [\n---\n# Privacy\n",
+	})
+
+	p := New(dirfs.New(t.TempDir()), Options{Resilient: true})
+
+	err := p.Parse(sourceFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := p.Report()
+	if report.Manuals != 1 {
+		t.Errorf("expected 1 manual, got %d", report.Manuals)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].File != "campaigns/generic/privacy/languages/en-US.md" || report.Errors[0].Stage != StageFrontMatter {
+		t.Fatalf("expected a front matter error for the privacy manual, got %v", report.Errors)
+	}
+
+	current, err := p.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fileExists(current, "campaigns/generic/faq/en-US/index.html") {
+		t.Error("expected the FAQ manual to be parsed")
+	}
+	if fileExists(current, "campaigns/generic/privacy/en-US/index.html") {
+		t.Error("expected the privacy manual to be skipped")
+	}
+	if !fileExists(current, BuildReportFileName) {
+		t.Error("expected the build report to be written")
+	}
+}
+
+func TestParseStopsAtFirstError(t *testing.T) {
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/privacy/languages/en-US.md": "---\ntitle: [\n---\n# Privacy\n",
+	})
+
+	p := New(dirfs.New(t.TempDir()), Options{})
+
+	err := p.Parse(sourceFS)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	_, err = p.Current()
+	if err != ErrNoGeneration {
+		t.Fatalf("expected %v, got %v", ErrNoGeneration, err)
+	}
+}
+
+// Create a LabDirSource in a temporary directory that contains files by path.
+func newTestLabDirSource(t *testing.T, files map[string]string) fs.FS {
+	dir := t.TempDir()
+
+	for filePath, content := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(filePath))
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(fullPath, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sourceFS, err := NewLabDirSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sourceFS
+}
+
+func TestParseDeviceRepoAuthenticationRequired(t *testing.T) {
+	// A git server that needs credentials for every request.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"campaigns/generic/faq/languages/en-US.md": "# FAQ\n",
+		"devices/private-device/details.json":      `{"firmware_repository": "` + server.URL + `/private-device.git"}`,
+	})
+
+	p := New(dirfs.New(t.TempDir()), Options{Resilient: true})
+
+	err := p.Parse(sourceFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := p.Report().Errors
+	if len(errs) != 1 || errs[0].Stage != StageDeviceRepo || !errors.Is(errs[0], transport.ErrAuthenticationRequired) {
+		t.Fatalf("expected an authentication error for the device repository, got %v", errs)
+	}
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+	"github.com/gomarkdown/markdown/ast"
+)
+
+const (
+	// Name of the directory at the root of a generation that contains a search index for every language,
+	// in a file named after the language (e.g. search/nl-NL.json).
+	SearchIndexDirName = "search"
+)
+
+// A SearchIndex contains the text of all manuals in a language, so they can be searched.
+type SearchIndex struct {
+	Language  string           `json:"language"`
+	Documents []SearchDocument `json:"documents"`
+}
+
+// A SearchDocument is the text of a manual in a SearchIndex.
+type SearchDocument struct {
+	// URL of the manual in the language of the index.
+	URL   string `json:"url"`
+	Title string `json:"title"`
+
+	// Category of the manual: devices, energy_queries, cloud_feeds or campaigns.
+	Category string `json:"category"`
+	// Name of the device, energy query or cloud feed the manual is for. Empty for campaign manuals.
+	Entity string `json:"entity,omitempty"`
+	// Display name of the entity in the language of the index.
+	DisplayName string `json:"display_name,omitempty"`
+	ManualType  string `json:"manual_type"`
+	Campaign    string `json:"campaign"`
+
+	Headings []SearchHeading `json:"headings"`
+
+	// Text of the manual, without its headings.
+	Text string `json:"text"`
+}
+
+// A SearchHeading is a heading in a SearchDocument.
+type SearchHeading struct {
+	// ID of the heading, which can be added to the URL of the manual to link to it.
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// searchIndexBuilder collects the text of manuals while parsing, to create a SearchIndex for every language.
+type searchIndexBuilder struct {
+	documents map[string][]SearchDocument
+}
+
+func newSearchIndexBuilder() *searchIndexBuilder {
+	return &searchIndexBuilder{
+		documents: map[string][]SearchDocument{},
+	}
+}
+
+// Add the manual at destFilePath in lang with title, parsed to doc with toc.
+func (b *searchIndexBuilder) addManual(destFilePath string, lang string, title string, doc ast.Node, toc TableOfContents) {
+	// e.g. devices/<device>/<manual_type>/<campaign>/languages/<lang>.md
+	// or campaigns/<campaign>/<manual_type>/languages/<lang>.md
+	splitPath := strings.Split(destFilePath, "/")
+
+	document := SearchDocument{
+		URL:      "/" + path.Join(splitPath[:len(splitPath)-2]...) + "/" + lang + "/",
+		Title:    title,
+		Headings: searchHeadings(toc),
+		Text:     searchText(doc),
+	}
+
+	switch {
+	case len(splitPath) == 6 && displayNameCategories[splitPath[0]]:
+		document.Category, document.Entity = splitPath[0], splitPath[1]
+		document.ManualType, document.Campaign = splitPath[2], splitPath[3]
+	case len(splitPath) == 5 && splitPath[0] == "campaigns":
+		document.Category = splitPath[0]
+		document.Campaign, document.ManualType = splitPath[1], splitPath[2]
+	default:
+		return
+	}
+
+	b.documents[lang] = append(b.documents[lang], document)
+}
+
+// Create the search index of every language. Documents are sorted by URL.
+// The display names of entities are taken from catalog.
+func (b *searchIndexBuilder) build(catalog *catalogBuilder) []SearchIndex {
+	indexes := []SearchIndex{}
+
+	for _, lang := range sortedKeys(b.documents) {
+		documents := b.documents[lang]
+		sort.Slice(documents, func(i, j int) bool {
+			return documents[i].URL < documents[j].URL
+		})
+
+		for i, document := range documents {
+			if document.Entity != "" {
+				documents[i].DisplayName = catalog.entity(document.Category, document.Entity).displayNames[lang]
+			}
+		}
+
+		indexes = append(indexes, SearchIndex{Language: lang, Documents: documents})
+	}
+
+	return indexes
+}
+
+// Write the search index of every language to the staging filesystem.
+func (p *Parser) writeSearchIndexes() error {
+	err := wfs.MkdirAll(p.stagingFS, SearchIndexDirName, fs.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range p.search.build(p.catalog) {
+		data, err := json.Marshal(index)
+		if err != nil {
+			return err
+		}
+
+		err = wfs.WriteFile(p.stagingFS, path.Join(SearchIndexDirName, index.Language+".json"), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return the headings in toc in the order they appear in the manual.
+func searchHeadings(toc TableOfContents) []SearchHeading {
+	headings := []SearchHeading{}
+
+	for _, entry := range toc {
+		headings = append(headings, SearchHeading{ID: entry.ID, Title: entry.Title})
+		headings = append(headings, searchHeadings(entry.Children)...)
+	}
+
+	return headings
+}
+
+// Return the text in doc, without headings and with blocks separated by a space.
+func searchText(doc ast.Node) string {
+	var b strings.Builder
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch node := node.(type) {
+		case *ast.Heading:
+			return ast.SkipChildren
+		case *ast.Text:
+			b.Write(node.Literal)
+		case *ast.Code:
+			b.Write(node.Literal)
+		case *ast.CodeBlock:
+			b.Write(node.Literal)
+			b.WriteByte(' ')
+		case *ast.Softbreak, *ast.Hardbreak:
+			b.WriteByte(' ')
+		case *ast.Paragraph, *ast.ListItem, *ast.TableCell:
+			if !entering {
+				b.WriteByte(' ')
+			}
+		}
+
+		return ast.GoToNext
+	})
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"encoding/json"
+	"io/fs"
+	"testing"
+
+	"github.com/energietransitie/needforheat-manual-server/wfs/dirfs"
+)
+
+func TestParseSearchIndex(t *testing.T) {
+	sourceFS := newTestLabDirSource(t, map[string]string{
+		"devices/smart-meter/display_names.json":                      `{"nl-NL": "Slimme meter"}`,
+		"devices/smart-meter/installation/generic/languages/nl-NL.md": "# Installatie\n\n## De meter aansluiten\n\nSteek de kabel in de **P1-poort**.\n",
+		"campaigns/generic/faq/languages/nl-NL.md":                    "# Veelgestelde vragen\n\n- Eén\n- Twee\n",
+	})
+
+	p := New(dirfs.New(t.TempDir()), Options{})
+	err := p.Parse(sourceFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := p.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(current, "search/nl-NL.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var index SearchIndex
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index.Documents) != 2 {
+		t.Fatalf("expected 2 documents, got %+v", index.Documents)
+	}
+
+	faq, installation := index.Documents[0], index.Documents[1]
+
+	if faq.URL != "/campaigns/generic/faq/nl-NL/" || faq.Category != "campaigns" || faq.Campaign != "generic" || faq.ManualType != "faq" || faq.Text != "Eén Twee" {
+		t.Errorf("unexpected document %+v", faq)
+	}
+
+	if installation.Entity != "smart-meter" || installation.DisplayName != "Slimme meter" || installation.Text != "Steek de kabel in de P1-poort." {
+		t.Errorf("unexpected document %+v", installation)
+	}
+
+	if len(installation.Headings) != 1 || installation.Headings[0] != (SearchHeading{ID: "de-meter-aansluiten", Title: "De meter aansluiten"}) {
+		t.Errorf("unexpected headings %+v", installation.Headings)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	searcher := NewSearcher(SearchIndex{
+		Language: "nl-NL",
+		Documents: []SearchDocument{
+			{
+				URL:   "/campaigns/generic/faq/nl-NL/",
+				Title: "Veelgestelde vragen",
+				Headings: []SearchHeading{
+					{ID: "wifi", Title: "Hoe verbind ik met wifi?"},
+					{ID: "reset", Title: "Hoe reset ik de meter?"},
+				},
+				Text: "Houd de knop tien seconden ingedrukt om de meter te resetten. Daarna knippert het lampje één keer.",
+			},
+			{
+				URL:         "/devices/smart-meter/installation/generic/nl-NL/",
+				Title:       "Installatie",
+				Entity:      "smart-meter",
+				DisplayName: "Slimme meter",
+				Text:        "Steek de kabel in de P1-poort van de meter.",
+			},
+			{
+				URL:   "/campaigns/generic/privacy/nl-NL/",
+				Title: "Privacy",
+				Text:  "Wij bewaren je gegevens veilig.",
+			},
+		},
+	})
+
+	results := searcher.Search("meter reset", 10)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	if results[0].URL != "/campaigns/generic/faq/nl-NL/#reset" || results[0].Heading != "Hoe reset ik de meter?" {
+		t.Errorf("expected the reset heading first, got %+v", results[0])
+	}
+
+	if results[1].DisplayName != "Slimme meter" || results[0].Score <= results[1].Score {
+		t.Errorf("unexpected second result %+v", results[1])
+	}
+
+	results = searcher.Search("EEN", 10)
+	if len(results) != 1 || results[0].Snippet != "…de meter te resetten. Daarna knippert het lampje één keer" {
+		t.Errorf("expected diacritics to be ignored, got %+v", results)
+	}
+
+	results = searcher.Search("gegev", 10)
+	if len(results) != 1 || results[0].Title != "Privacy" {
+		t.Errorf("expected prefix to match, got %+v", results)
+	}
+
+	if results := searcher.Search("meter", 1); len(results) != 1 {
+		t.Errorf("expected limit to be applied, got %+v", results)
+	}
+
+	if results := searcher.Search("?!", 10); len(results) != 0 {
+		t.Errorf("expected no results, got %+v", results)
+	}
+}
@@ -0,0 +1,307 @@
+package parser
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// Approximate length of a snippet in bytes.
+	snippetLength = 160
+	// Number of words before the first match that are included in a snippet.
+	snippetContextWords = 8
+
+	// Minimum length of a query term for it to match words that start with it.
+	minPrefixLength = 3
+
+	// Weights of the fields of a document.
+	titleWeight       = 4
+	displayNameWeight = 3
+	headingWeight     = 2
+	textWeight        = 1
+)
+
+// A SearchResult is a manual that matches a search query.
+type SearchResult struct {
+	Title string `json:"title"`
+	// URL of the manual, or of the heading that matches best.
+	URL string `json:"url"`
+
+	Category    string `json:"category"`
+	Entity      string `json:"entity,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	ManualType  string `json:"manual_type"`
+	Campaign    string `json:"campaign"`
+
+	// Heading that matches best, if any heading matches.
+	Heading string `json:"heading,omitempty"`
+
+	// Part of the text of the manual around the first match.
+	Snippet string `json:"snippet"`
+
+	// Relevance of the result. Results are sorted by score, from high to low.
+	Score float64 `json:"score"`
+}
+
+// A Searcher searches the documents in a SearchIndex.
+type Searcher struct {
+	documents []searchableDocument
+}
+
+// A document with its fields split in words.
+type searchableDocument struct {
+	SearchDocument
+
+	title       []searchWord
+	displayName []searchWord
+	headings    [][]searchWord
+	text        []searchWord
+}
+
+// A word in a text, with its position in the text.
+type searchWord struct {
+	// Word in lowercase, without diacritics.
+	term  string
+	start int
+	end   int
+}
+
+// Create a Searcher for the documents in index.
+func NewSearcher(index SearchIndex) *Searcher {
+	searcher := &Searcher{}
+
+	for _, document := range index.Documents {
+		searchable := searchableDocument{
+			SearchDocument: document,
+			title:          splitWords(document.Title),
+			displayName:    splitWords(document.DisplayName),
+			text:           splitWords(document.Text),
+		}
+
+		for _, heading := range document.Headings {
+			searchable.headings = append(searchable.headings, splitWords(heading.Title))
+		}
+
+		searcher.documents = append(searcher.documents, searchable)
+	}
+
+	return searcher
+}
+
+// Return at most limit documents that match query, with the most relevant first.
+//
+// Words are matched without case and diacritics, so 'een' matches 'één'.
+// Query terms of at least 3 letters also match words that start with them.
+// Documents that match more of the query terms are ranked higher, and matches in titles
+// and headings count more than matches in the text.
+func (s *Searcher) Search(query string, limit int) []SearchResult {
+	var terms []string
+	for _, word := range splitWords(query) {
+		terms = append(terms, word.term)
+	}
+
+	results := []SearchResult{}
+	if len(terms) == 0 {
+		return results
+	}
+
+	// Number of documents every term matches, to weigh rare terms higher.
+	frequencies := make([]int, len(terms))
+	for _, document := range s.documents {
+		for i, term := range terms {
+			if document.matches(term) {
+				frequencies[i]++
+			}
+		}
+	}
+
+	for _, document := range s.documents {
+		score, matched := 0.0, 0
+		bestHeading, bestHeadingScore := -1, 0.0
+		headingScores := make([]float64, len(document.headings))
+
+		for i, term := range terms {
+			if frequencies[i] == 0 || !document.matches(term) {
+				continue
+			}
+			matched++
+
+			idf := math.Log(1 + (float64(len(s.documents)-frequencies[i])+0.5)/(float64(frequencies[i])+0.5))
+
+			termScore := titleWeight*saturate(matchCount(document.title, term)) +
+				displayNameWeight*saturate(matchCount(document.displayName, term)) +
+				textWeight*saturate(matchCount(document.text, term))
+
+			headingScore := 0.0
+			for j, heading := range document.headings {
+				count := saturate(matchCount(heading, term))
+				headingScores[j] += count
+				headingScore = math.Max(headingScore, count)
+			}
+			termScore += headingWeight * headingScore
+
+			score += idf * termScore
+		}
+
+		if matched == 0 {
+			continue
+		}
+
+		// Documents that match all terms come first.
+		score *= float64(matched) / float64(len(terms))
+
+		for j, headingScore := range headingScores {
+			if headingScore > bestHeadingScore {
+				bestHeading, bestHeadingScore = j, headingScore
+			}
+		}
+
+		result := SearchResult{
+			Title:       document.Title,
+			URL:         document.URL,
+			Category:    document.Category,
+			Entity:      document.Entity,
+			DisplayName: document.DisplayName,
+			ManualType:  document.ManualType,
+			Campaign:    document.Campaign,
+			Snippet:     snippet(document.Text, document.text, terms),
+			Score:       math.Round(score*1000) / 1000,
+		}
+
+		if bestHeading >= 0 {
+			heading := document.Headings[bestHeading]
+			result.Heading = heading.Title
+			result.URL += "#" + heading.ID
+		}
+
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].URL < results[j].URL
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// Return if any field of d matches term.
+func (d searchableDocument) matches(term string) bool {
+	if matchCount(d.title, term) > 0 || matchCount(d.displayName, term) > 0 || matchCount(d.text, term) > 0 {
+		return true
+	}
+
+	for _, heading := range d.headings {
+		if matchCount(heading, term) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return how well term matches words. An exact match counts as 1 and a prefix match as 0.5.
+func matchCount(words []searchWord, term string) float64 {
+	count := 0.0
+
+	for _, word := range words {
+		if word.term == term {
+			count++
+		} else if len(term) >= minPrefixLength && strings.HasPrefix(word.term, term) {
+			count += 0.5
+		}
+	}
+
+	return count
+}
+
+// Return count with diminishing returns, so a word that occurs many times does not dominate.
+func saturate(count float64) float64 {
+	const k = 1.2
+	return count * (k + 1) / (count + k)
+}
+
+// Return the part of text around the first word in words that matches any of terms.
+// words are the words of text. The start of text is returned if no word matches.
+func snippet(text string, words []searchWord, terms []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+
+	first := 0
+search:
+	for i, word := range words {
+		for _, term := range terms {
+			if matchCount([]searchWord{word}, term) > 0 {
+				first = i
+				break search
+			}
+		}
+	}
+
+	start := first - snippetContextWords
+	if start < 0 {
+		start = 0
+	}
+
+	end := first
+	for end < len(words)-1 && words[end+1].end-words[start].start <= snippetLength {
+		end++
+	}
+
+	s := text[words[start].start:words[end].end]
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(words)-1 {
+		s += "…"
+	}
+
+	return s
+}
+
+// Split s in words of letters and numbers.
+func splitWords(s string) []searchWord {
+	var words []searchWord
+
+	start := -1
+	for i, r := range s {
+		isWordRune := unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			words = append(words, searchWord{term: foldTerm(s[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, searchWord{term: foldTerm(s[start:]), start: start, end: len(s)})
+	}
+
+	return words
+}
+
+// Return word in lowercase and without diacritics (e.g. 'Één' becomes 'een').
+func foldTerm(word string) string {
+	var b strings.Builder
+
+	for _, r := range norm.NFD.String(word) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
@@ -1,21 +1,32 @@
 package parser
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
-	"path"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
 var (
-	ErrNotSourceFS = errors.New("parser: type does not implement SourceFS interface")
+	ErrNotSourceFS   = errors.New("parser: type does not implement SourceFS interface")
+	ErrNotRevisionFS = errors.New("parser: type does not implement RevisionFS interface")
 )
 
+// Matches (abbreviated) commit hashes.
+var commitHashRegExp = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
 // Source is an interface for a filesystem that can be used as a source for a Parser.
 type SourceFS interface {
 	// Get the path to copy a file to at the destination filesystem.
@@ -49,36 +60,383 @@ func GetDestinationDirPath(source fs.FS, dirPath string) (string, error) {
 	return "", ErrNotSourceFS
 }
 
+// A Revision describes which revision of a git repository is used as a source.
+type Revision struct {
+	// URL of the git repository.
+	URL string `json:"url"`
+
+	// Reference that was cloned (e.g. a branch or tag), or empty for the default branch.
+	Reference string `json:"reference,omitempty"`
+
+	// Hash of the commit that was cloned.
+	Commit string `json:"commit"`
+}
+
+// RevisionFS is an interface for a source filesystem that is a revision of a git repository.
+type RevisionFS interface {
+	// Get the revision of the git repository the source contains.
+	Revision() Revision
+}
+
+// Get the revision of the git repository source contains.
+//
+// An error will be returned if source is not a RevisionFS.
+func GetRevision(source fs.FS) (Revision, error) {
+	if source, ok := source.(RevisionFS); ok {
+		return source.Revision(), nil
+	}
+	return Revision{}, ErrNotRevisionFS
+}
+
+// UpdateFS is an interface for a source filesystem that stages updates of its contents in the background.
+// A staged update is only used once it is installed, so the contents do not change while they are parsed.
+type UpdateFS interface {
+	// Install the update that was staged, if any. Returns if the contents changed.
+	InstallUpdate() (bool, error)
+}
+
+// Install the update of source that was staged, if any. Returns if the contents of source changed.
+//
+// Sources that do not stage updates are left alone.
+func InstallUpdate(source fs.FS) (bool, error) {
+	if source, ok := source.(UpdateFS); ok {
+		return source.InstallUpdate()
+	}
+	return false, nil
+}
+
+// Close releases resources held by source, such as a temporary clone of a git repository.
+//
+// Sources that do not hold any resources are left alone.
+func Close(source fs.FS) error {
+	if source, ok := source.(io.Closer); ok {
+		return source.Close()
+	}
+	return nil
+}
+
+// gitRepo is a filesystem for a clone of a git repository.
+//
+// A newer clone can be staged using update, which replaces the clone when it is installed using InstallUpdate.
+type gitRepo struct {
+	url       string
+	name      string
+	reference plumbing.ReferenceName
+	auth      transport.AuthMethod
+
+	// Revision of a specific commit to clone, instead of the commit reference points to.
+	commit string
+
+	mu   sync.RWMutex
+	fsys fs.FS
+	dir  string
+	hash plumbing.Hash
+
+	// Newer clone that was staged by update, or empty if there is none.
+	stagedDir  string
+	stagedHash plumbing.Hash
+}
+
 // Create a new source filesystem from a git repo at url.
-func newGitFSWithAuth(url string, branch string, auth transport.AuthMethod) (fs.FS, string, error) {
+//
+// The default branch is cloned, unless branch or ref is set. ref can be a tag,
+// a (abbreviated) commit hash or a full reference name (e.g. refs/heads/main).
+// A ref that looks like a commit hash is used as a tag if the repository has a tag with that name.
+// Only one of branch and ref can be set.
+//
+// An error wrapping ErrSourceInvalid is returned if url is not a git URL.
+func newGitFSWithAuth(url string, branch string, ref string, auth transport.AuthMethod) (*gitRepo, error) {
+	sourceURL, err := ParseSourceURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sourceURL.IsGit() {
+		return nil, fmt.Errorf("%w: %s is not a git URL", ErrSourceInvalid, RedactURL(url))
+	}
+
+	repo := &gitRepo{
+		url:  url,
+		name: sourceURL.Name(),
+		auth: auth,
+	}
+
+	switch {
+	case branch != "" && ref != "":
+		return nil, fmt.Errorf("%w: %s: both a branch and a ref are set", ErrSourceInvalid, RedactURL(url))
+	case branch != "":
+		repo.reference = plumbing.NewBranchReferenceName(branch)
+	case strings.HasPrefix(ref, "refs/"):
+		repo.reference = plumbing.ReferenceName(ref)
+	case commitHashRegExp.MatchString(ref):
+		// A tag can look like a commit hash, so ref is only used as a commit if there is no tag with that name.
+		isTag, err := repo.hasRemoteTag(context.Background(), ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if isTag {
+			repo.reference = plumbing.NewTagReferenceName(ref)
+		} else {
+			repo.commit = ref
+		}
+	case ref != "":
+		repo.reference = plumbing.NewTagReferenceName(ref)
+	}
+
+	dir, hash, err := repo.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.fsys = os.DirFS(dir)
+	repo.dir = dir
+	repo.hash = hash
+
+	return repo, nil
+}
+
+// Open opens the named file in the current clone of the repository.
+func (r *gitRepo) Open(name string) (fs.File, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.fsys.Open(name)
+}
+
+// Get the revision of the current clone of the repository.
+func (r *gitRepo) Revision() Revision {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reference := r.commit
+	if r.reference != "" {
+		reference = r.reference.String()
+	}
+
+	return Revision{
+		URL:       RedactURL(r.url),
+		Reference: reference,
+		Commit:    r.hash.String(),
+	}
+}
+
+// Returns if the clone is pinned to a tag or commit, which are not expected to change.
+func (r *gitRepo) pinned() bool {
+	return r.commit != "" || r.reference.IsTag()
+}
+
+// Close removes the clone of the repository and the clone that was staged, if any.
+func (r *gitRepo) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stagedDir != "" {
+		os.RemoveAll(r.stagedDir)
+		r.stagedDir = ""
+	}
+
+	return os.RemoveAll(r.dir)
+}
+
+// Stage a new clone of the repository if the remote reference points to a new commit.
+// The clone that is used does not change until the staged clone is installed using InstallUpdate,
+// so a Parser never reads files from two commits.
+//
+// Returns if a new clone was staged.
+func (r *gitRepo) update(ctx context.Context) (bool, error) {
+	remoteHash, err := r.remoteHash(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	latestHash := r.hash
+	if r.stagedDir != "" {
+		latestHash = r.stagedHash
+	}
+	r.mu.RUnlock()
+
+	if remoteHash == latestHash {
+		return false, nil
+	}
+
+	dir, hash, err := r.clone()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	oldStagedDir := r.stagedDir
+	r.stagedDir = dir
+	r.stagedHash = hash
+	r.mu.Unlock()
+
+	// A staged clone is never read, so it can be removed right away.
+	if oldStagedDir != "" {
+		return true, os.RemoveAll(oldStagedDir)
+	}
+
+	return true, nil
+}
+
+// InstallUpdate replaces the clone of the repository with the clone that was staged by update, if any,
+// and removes the previous clone.
+//
+// Returns if the clone was replaced.
+func (r *gitRepo) InstallUpdate() (bool, error) {
+	r.mu.Lock()
+	if r.stagedDir == "" {
+		r.mu.Unlock()
+		return false, nil
+	}
+
+	oldDir := r.dir
+	r.fsys = os.DirFS(r.stagedDir)
+	r.dir = r.stagedDir
+	r.hash = r.stagedHash
+	r.stagedDir = ""
+	r.mu.Unlock()
+
+	return true, os.RemoveAll(oldDir)
+}
+
+// Clone the repository into a new temporary directory.
+//
+// Returns the directory and the hash of the commit that was checked out.
+func (r *gitRepo) clone() (string, plumbing.Hash, error) {
 	dir, err := mkdirTemp()
 	if err != nil {
-		return nil, "", err
+		return "", plumbing.ZeroHash, err
 	}
 
-	opts := &git.CloneOptions{
-		URL:   url,
-		Auth:  auth,
-		Depth: 1,
+	hash, err := r.cloneTo(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", plumbing.ZeroHash, err
 	}
 
-	if branch != "" {
-		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	log.Println("cloned", RedactURL(r.url), "at", hash.String())
+
+	return dir, hash, nil
+}
+
+// Clone the repository into dir and return the hash of the commit that was checked out.
+func (r *gitRepo) cloneTo(dir string) (plumbing.Hash, error) {
+	if r.commit == "" {
+		opts := &git.CloneOptions{
+			URL:           r.url,
+			Auth:          r.auth,
+			Depth:         1,
+			ReferenceName: r.reference,
+			SingleBranch:  r.reference != "",
+		}
+
+		repo, err := git.PlainClone(dir, false, opts)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		ref, err := repo.Head()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return ref.Hash(), nil
+	}
+
+	// A specific commit cannot be fetched on its own,
+	// so the full history is needed to check it out.
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{
+		URL:        r.url,
+		Auth:       r.auth,
+		NoCheckout: true,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
 	}
 
-	repo, err := git.PlainClone(dir, false, opts)
+	hash, err := repo.ResolveRevision(plumbing.Revision(r.commit))
 	if err != nil {
-		return nil, "", err
+		return plumbing.ZeroHash, fmt.Errorf("commit %s: %w", r.commit, err)
 	}
 
-	ref, err := repo.Head()
+	worktree, err := repo.Worktree()
 	if err != nil {
-		return nil, "", err
+		return plumbing.ZeroHash, err
+	}
+
+	err = worktree.Checkout(&git.CheckoutOptions{
+		Hash:  *hash,
+		Force: true,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return *hash, nil
+}
+
+// Get the hash of the commit the reference points to at the remote.
+//
+// The clone is not used, so it can be replaced while the remote is checked.
+func (r *gitRepo) remoteHash(ctx context.Context) (plumbing.Hash, error) {
+	refs, err := r.remoteReferences(ctx)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	name := r.reference
+	if name == "" {
+		name = plumbing.HEAD
 	}
 
-	log.Println("cloned", url, "at", ref.Hash().String())
+	// HEAD can be a symbolic reference to the default branch,
+	// so keep resolving until a hash is found.
+	for i := 0; i < 10; i++ {
+		ref := findReference(refs, name)
+		if ref == nil {
+			break
+		}
 
-	return os.DirFS(dir), path.Base(url), err
+		if ref.Type() == plumbing.HashReference {
+			return ref.Hash(), nil
+		}
+
+		name = ref.Target()
+	}
+
+	return plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+}
+
+// Report if the remote has a tag with name.
+func (r *gitRepo) hasRemoteTag(ctx context.Context, name string) (bool, error) {
+	refs, err := r.remoteReferences(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return findReference(refs, plumbing.NewTagReferenceName(name)) != nil, nil
+}
+
+// List the references of the remote. The clone is not used.
+func (r *gitRepo) remoteReferences(ctx context.Context) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{r.url},
+	})
+
+	return remote.ListContext(ctx, &git.ListOptions{Auth: r.auth})
+}
+
+// Return the reference with name from refs, or nil if it is not in refs.
+func findReference(refs []*plumbing.Reference, name plumbing.ReferenceName) *plumbing.Reference {
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref
+		}
+	}
+	return nil
 }
 
 // Create a new temporary directory.
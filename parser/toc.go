@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Text of a paragraph that is replaced by the table of contents.
+const tocMarker = "[TOC]"
+
+// A TOCEntry is a heading in the table of contents of a manual.
+type TOCEntry struct {
+	// Level of the heading, from 1 to 6.
+	Level int
+	// ID of the heading, which can be used to link to it (e.g. '#installatie-van-de-meter').
+	ID    string
+	Title string
+
+	// Headings below this heading with a higher level.
+	Children []*TOCEntry
+}
+
+// TableOfContents of a manual, with headings nested by their level.
+// The title of the manual is not included.
+type TableOfContents []*TOCEntry
+
+// Return the table of contents as nested lists of links to the headings.
+func (toc TableOfContents) HTML() template.HTML {
+	if len(toc) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<nav class=\"toc\">\n")
+	writeTOCList(&b, toc)
+	b.WriteString("</nav>\n")
+
+	return template.HTML(b.String())
+}
+
+// Write entries as a list to b.
+func writeTOCList(b *strings.Builder, entries []*TOCEntry) {
+	b.WriteString("<ul>\n")
+
+	for _, entry := range entries {
+		b.WriteString("<li><a href=\"#" + template.HTMLEscapeString(entry.ID) + "\">" + template.HTMLEscapeString(entry.Title) + "</a>")
+		if len(entry.Children) > 0 {
+			b.WriteString("\n")
+			writeTOCList(b, entry.Children)
+		}
+		b.WriteString("</li>\n")
+	}
+
+	b.WriteString("</ul>\n")
+}
+
+// A node that is rendered as the table of contents.
+type tocPlaceholder struct {
+	ast.Leaf
+}
+
+// Give every heading in doc an ID that is unique in doc and return the table of contents of doc.
+//
+// Headings that have an ID set in markdown (e.g. '## Installation {#install}') keep it.
+// Other headings get an ID from their text, which is made unique by adding a number.
+func newTableOfContents(doc ast.Node) TableOfContents {
+	used := map[string]bool{}
+	var headings []*ast.Heading
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok && entering {
+			headings = append(headings, heading)
+			if heading.HeadingID != "" {
+				used[heading.HeadingID] = true
+			}
+		}
+
+		return ast.GoToNext
+	})
+
+	var toc TableOfContents
+	// Stack of the entries that new entries can be nested in.
+	var parents []*TOCEntry
+
+	for i, heading := range headings {
+		title := nodeText(heading)
+
+		if heading.HeadingID == "" {
+			heading.HeadingID = uniqueSlug(slugify(title), used)
+		}
+
+		// The title of the manual links to the manual itself.
+		if i == 0 && heading.Level == 1 && isFirstBlock(doc, heading) {
+			continue
+		}
+
+		entry := &TOCEntry{
+			Level: heading.Level,
+			ID:    heading.HeadingID,
+			Title: title,
+		}
+
+		for len(parents) > 0 && parents[len(parents)-1].Level >= entry.Level {
+			parents = parents[:len(parents)-1]
+		}
+
+		if len(parents) == 0 {
+			toc = append(toc, entry)
+		} else {
+			parent := parents[len(parents)-1]
+			parent.Children = append(parent.Children, entry)
+		}
+
+		parents = append(parents, entry)
+	}
+
+	return toc
+}
+
+// Replace every paragraph in doc that only contains the table of contents marker
+// with a placeholder for the table of contents.
+func replaceTOCMarkers(doc ast.Node) {
+	var paragraphs []*ast.Paragraph
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if paragraph, ok := node.(*ast.Paragraph); ok && entering {
+			if strings.EqualFold(strings.TrimSpace(nodeText(paragraph)), tocMarker) {
+				paragraphs = append(paragraphs, paragraph)
+			}
+			return ast.SkipChildren
+		}
+
+		return ast.GoToNext
+	})
+
+	for _, paragraph := range paragraphs {
+		placeholder := &tocPlaceholder{}
+		placeholder.Parent = paragraph.Parent
+
+		siblings := paragraph.Parent.GetChildren()
+		for i, sibling := range siblings {
+			if sibling == paragraph {
+				siblings[i] = placeholder
+			}
+		}
+	}
+}
+
+// Return the plain text of node and its children.
+func nodeText(node ast.Node) string {
+	var b bytes.Buffer
+
+	ast.WalkFunc(node, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+
+		switch node := node.(type) {
+		case *ast.Text:
+			b.Write(node.Literal)
+		case *ast.Code:
+			b.Write(node.Literal)
+		case *ast.Softbreak, *ast.Hardbreak:
+			b.WriteByte(' ')
+		}
+
+		return ast.GoToNext
+	})
+
+	return strings.TrimSpace(b.String())
+}
+
+// Return if node is the first child of doc.
+func isFirstBlock(doc ast.Node, node ast.Node) bool {
+	children := doc.GetChildren()
+	return len(children) > 0 && children[0] == node
+}
+
+// Make a slug of s that can be used as an ID.
+//
+// Letters are lowercased and kept with their accents (e.g. 'Één meter' becomes 'één-meter').
+// Everything else that is not a letter or number is replaced with a dash.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range norm.NFC.String(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.IsMark(r):
+			// Combining marks that could not be composed belong to the letter before them.
+			if b.Len() > 0 && !dash {
+				b.WriteRune(r)
+			}
+		default:
+			dash = true
+		}
+	}
+
+	if b.Len() == 0 {
+		return "section"
+	}
+
+	return b.String()
+}
+
+// Return slug, or slug with the lowest number added that makes it unique in used.
+// The returned slug is added to used.
+func uniqueSlug(slug string, used map[string]bool) string {
+	unique := slug
+	for i := 1; used[unique]; i++ {
+		unique = slug + "-" + strconv.Itoa(i)
+	}
+
+	used[unique] = true
+	return unique
+}
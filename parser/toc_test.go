@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Installation":                 "installation",
+		"Één meter, twee sensoren!":    "één-meter-twee-sensoren",
+		"Ge\u0301e\u0308n probleem":    "géën-probleem",
+		"  Stap 2: de `P1`-poort  ":    "stap-2-de-p1-poort",
+		"Wat is de ĲSSEL-aansluiting?": "wat-is-de-ĳssel-aansluiting",
+		"???":                          "section",
+	}
+
+	for input, expected := range tests {
+		slug := slugify(input)
+		if slug != expected {
+			t.Errorf("slugify(%q): expected %q, got %q", input, expected, slug)
+		}
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	md := "# Handleiding\n\n[TOC]\n\n## Installatie\n\n### Stap één\n\n### Stap één\n\n## Vragen {#faq}\n\n#### Diep\n\n## FAQ\n"
+
+	doc := parseMarkdown([]byte(md), nil)
+	toc := newTableOfContents(doc)
+
+	var entries []string
+	var walk func(entries []*TOCEntry, depth int) []string
+	walk = func(toc []*TOCEntry, depth int) []string {
+		var lines []string
+		for _, entry := range toc {
+			lines = append(lines, strings.Repeat("  ", depth)+entry.ID+" "+entry.Title)
+			lines = append(lines, walk(entry.Children, depth+1)...)
+		}
+		return lines
+	}
+	entries = walk(toc, 0)
+
+	expected := []string{
+		"installatie Installatie",
+		"  stap-één Stap één",
+		"  stap-één-1 Stap één",
+		"faq Vragen",
+		"  diep Diep",
+		"faq-1 FAQ",
+	}
+
+	if strings.Join(entries, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(entries, "\n"))
+	}
+
+	rendered := string(renderMarkdown(doc, toc))
+
+	for _, s := range []string{
+		`<h1 id="handleiding">Handleiding</h1>`,
+		`<h3 id="stap-één-1">Stap één</h3>`,
+		`<h2 id="faq-1">FAQ</h2>`,
+		"<nav class=\"toc\">\n<ul>\n<li><a href=\"#installatie\">Installatie</a>\n<ul>\n<li><a href=\"#stap-één\">Stap één</a></li>",
+	} {
+		if !strings.Contains(rendered, s) {
+			t.Errorf("expected rendered HTML to contain %q, got:\n%s", s, rendered)
+		}
+	}
+
+	if strings.Contains(rendered, tocMarker) {
+		t.Errorf("expected marker to be replaced, got:\n%s", rendered)
+	}
+}
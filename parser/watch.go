@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+)
+
+var (
+	ErrNotWatchFS = errors.New("parser: type does not implement WatchFS interface")
+)
+
+// WatchFS is an interface for a source filesystem that can report changes to its contents.
+type WatchFS interface {
+	// Watch reports on changed every time the contents of the source changed,
+	// until ctx is cancelled.
+	//
+	// Sources that cannot be notified of changes check for changes every pollInterval.
+	Watch(ctx context.Context, pollInterval time.Duration, changed chan<- struct{}) error
+}
+
+// Watch source for changes and report them on changed, until ctx is cancelled.
+// Use a buffered channel, so changes that are reported while a change is still pending are combined.
+//
+// An error will be returned if source is not a WatchFS.
+func Watch(ctx context.Context, source fs.FS, pollInterval time.Duration, changed chan<- struct{}) error {
+	if source, ok := source.(WatchFS); ok {
+		return source.Watch(ctx, pollInterval, changed)
+	}
+	return ErrNotWatchFS
+}
+
+// Report a change on changed without blocking when a change is already pending.
+func notify(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,145 @@
+package needforheatmanualserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"golang.org/x/text/language"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+var (
+	ErrSearchQueryMissing = errors.New("missing search query, set it with the q parameter")
+	ErrSearchLimitInvalid = errors.New("limit must be a positive number")
+	ErrSearchIndexMissing = errors.New("there is no search index")
+)
+
+// A SearchResponse contains the results of a search query.
+type SearchResponse struct {
+	Query string `json:"query"`
+	// Language of the manuals that were searched.
+	Language string                `json:"language"`
+	Results  []parser.SearchResult `json:"results"`
+}
+
+// Searchers of the search indexes in a filesystem, by language.
+type searchCache struct {
+	// Generation of the filesystem the searchers were created from.
+	generation int
+	searchers  map[string]*parser.Searcher
+}
+
+// Handle searching the manuals in a language.
+//
+// The query is set with the q parameter. The language is set with the lang parameter,
+// or chosen with the language cookie or the Accept-Language header. The number of results is set with the limit parameter.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+
+	query := strings.TrimSpace(params.Get("q"))
+	if query == "" {
+		return NewHandlerError(ErrSearchQueryMissing, http.StatusBadRequest)
+	}
+
+	limit := defaultSearchLimit
+	if limitParam := params.Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			return NewHandlerError(ErrSearchLimitInvalid, http.StatusBadRequest)
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+	}
+
+	fsys, generation := s.current()
+
+	lang, err := s.chooseSearchLanguage(w, fsys, s.languagePreferences(r))
+	if err != nil {
+		return err
+	}
+
+	searcher, err := s.searcher(fsys, generation, lang)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, SearchResponse{
+		Query:    query,
+		Language: lang,
+		Results:  searcher.Search(query, limit),
+	})
+}
+
+// Choose the language of the search index in fsys that best matches preferences.
+func (s *Server) chooseSearchLanguage(w http.ResponseWriter, fsys fs.FS, preferences []string) (string, error) {
+	entries, err := fs.ReadDir(fsys, parser.SearchIndexDirName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", NewHandlerError(err, http.StatusInternalServerError)
+	}
+
+	var tags []language.Tag
+	for _, entry := range entries {
+		tag, err := language.Parse(strings.TrimSuffix(entry.Name(), ".json"))
+		if err == nil && path.Ext(entry.Name()) == ".json" {
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) == 0 {
+		return "", NewHandlerError(ErrSearchIndexMissing, http.StatusNotFound)
+	}
+
+	return s.chooseLanguage(w, fsys, "", tags, preferences...).String(), nil
+}
+
+// Return the searcher of the search index for lang in fsys, which is the filesystem of generation.
+// Searchers are cached until the filesystem is replaced.
+func (s *Server) searcher(fsys fs.FS, generation int, lang string) (*parser.Searcher, error) {
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+
+	if generation > s.search.generation || s.search.searchers == nil {
+		s.search = searchCache{
+			generation: generation,
+			searchers:  map[string]*parser.Searcher{},
+		}
+	}
+
+	if generation == s.search.generation {
+		if searcher, ok := s.search.searchers[lang]; ok {
+			return searcher, nil
+		}
+	}
+
+	data, err := fs.ReadFile(fsys, path.Join(parser.SearchIndexDirName, lang+".json"))
+	if err != nil {
+		return nil, NewHandlerError(err, http.StatusNotFound)
+	}
+
+	var index parser.SearchIndex
+	err = json.Unmarshal(data, &index)
+	if err != nil {
+		return nil, NewHandlerError(err, http.StatusInternalServerError)
+	}
+
+	searcher := parser.NewSearcher(index)
+
+	// A request that started before the filesystem was replaced does not replace newer searchers.
+	if generation == s.search.generation {
+		s.search.searchers[lang] = searcher
+	}
+
+	return searcher, nil
+}
@@ -2,11 +2,14 @@ package needforheatmanualserver
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
 	"net/http"
 	"path"
 	"strings"
+	"sync"
 
+	"github.com/energietransitie/needforheat-manual-server/parser"
 	"github.com/go-chi/chi"
 	"golang.org/x/text/language"
 )
@@ -14,10 +17,30 @@ import (
 const (
 	genericCampaign    string = "generic"
 	manufacturerManual string = "manufacturer"
+
+	immutableCacheControl string = "public, max-age=31536000, immutable"
+
+	// Content-Security-Policy of assets, such as images. Scripts in SVG images that are opened directly do not run,
+	// and the assets cannot load anything else.
+	assetContentSecurityPolicy string = "default-src 'none'; style-src 'unsafe-inline'; sandbox"
 )
 
 type ServerOptions struct {
-	FallbackLanguage language.Tag
+	// FallbackLanguages are chosen, in order, when a client's languages do not match any available language.
+	// A campaign can prefer other languages with a fallback_languages.json file.
+	FallbackLanguages []language.Tag
+
+	// LanguageCookie persists the language set with the lang parameter in a cookie,
+	// so it is used for later requests without the parameter.
+	LanguageCookie bool
+
+	// CacheControl sets the Cache-Control header by kind of response.
+	// When it is nil, DefaultCacheControl is used.
+	CacheControl *CacheControl
+
+	// AdminToken is the bearer token needed for admin endpoints.
+	// Admin endpoints are disabled when it is empty.
+	AdminToken string
 }
 
 // A Server is a wrapper for an HTTP server that serves manuals from a filesystem.
@@ -25,8 +48,18 @@ type ServerOptions struct {
 // The Chi library is used and is fully compatible with net/http.
 type Server struct {
 	*chi.Mux
-	fsys    fs.FS
 	options ServerOptions
+
+	mu   sync.RWMutex
+	fsys fs.FS
+	// Manifest of fsys, with the content hash of every file.
+	manifest parser.Manifest
+
+	// Number of times the filesystem was replaced.
+	generation int
+
+	searchMu sync.Mutex
+	search   searchCache
 }
 
 // Create a new server that uses fsys as its filesystem to serve manuals.
@@ -34,47 +67,158 @@ func NewServer(fsys fs.FS, options ServerOptions) *Server {
 	r := chi.NewRouter()
 
 	server := &Server{
-		Mux:     r,
-		fsys:    fsys,
-		options: options,
+		Mux:      r,
+		fsys:     fsys,
+		manifest: readManifest(fsys),
+		options:  options,
 	}
 
-	r.Handle("/campaigns/{manual_type_name}/", Handler(server.handleCampaignGenericRedirect))
+	r.Handle("/api/v1/revisions/", server.handler(server.handleRevisions))
+
+	r.Handle("/api/v1/admin/build_report/", server.handler(server.adminMiddleware(server.handleBuildReport)))
+
+	r.Handle("/api/v1/catalog/", server.handler(server.handleCatalog))
+
+	r.Handle("/api/v1/search/", server.handler(server.handleSearch))
+
+	r.Handle("/api/v1/display_names/", server.handler(server.handleDisplayNames))
+
+	r.Handle("/api/v1/devices/", server.handler(server.handleCatalogSection(func(c parser.Catalog) any { return c.Devices })))
+
+	r.Handle("/api/v1/energy_queries/", server.handler(server.handleCatalogSection(func(c parser.Catalog) any { return c.EnergyQueries })))
+
+	r.Handle("/api/v1/cloud_feeds/", server.handler(server.handleCatalogSection(func(c parser.Catalog) any { return c.CloudFeeds })))
+
+	r.Handle("/api/v1/campaigns/", server.handler(server.handleCatalogSection(func(c parser.Catalog) any { return c.Campaigns })))
+
+	r.Handle("/campaigns/{manual_type_name}/", server.handler(server.handleCampaignGenericRedirect))
 
-	r.Handle("/campaigns/{campaign_name}/{manual_type_name}/", Handler(server.handleLanguageRedirect))
+	r.Handle("/campaigns/{campaign_name}/{manual_type_name}/", server.handler(server.handleLanguageRedirect))
 
-	r.Handle("/campaigns/{campaign_name}/{manual_type_name}/*", http.FileServer(http.FS(server.fsys)))
+	r.Handle("/campaigns/{campaign_name}/{manual_type_name}/*", server.handler(server.handleFile))
 
-	r.Handle("/devices/{device_type_name}/", Handler(server.handleDisplayName))
+	r.Handle("/devices/{device_type_name}/", server.handler(server.handleDisplayName))
 
-	r.Handle("/devices/{device_type_name}/{manual_type_name}/", Handler(server.handleDeviceGenericRedirect))
+	r.Handle("/devices/{device_type_name}/{manual_type_name}/", server.handler(server.handleDeviceGenericRedirect))
 
-	languageRedirectWithManufacturerFallback := manufacturerFallbackMiddleware(server.handleLanguageRedirect)
-	r.Handle("/devices/{device_type_name}/{manual_type_name}/{campaign_name}/", languageRedirectWithManufacturerFallback)
+	languageRedirectWithManufacturerFallback := server.manufacturerFallbackMiddleware(server.handleLanguageRedirect)
+	r.Handle("/devices/{device_type_name}/{manual_type_name}/{campaign_name}/", server.handler(languageRedirectWithManufacturerFallback))
 
-	r.Handle("/devices/{device_type_name}/{manual_type_name}/{campaign_name}/*", http.FileServer(http.FS(server.fsys)))
+	r.Handle("/devices/{device_type_name}/{manual_type_name}/{campaign_name}/*", server.handler(server.handleFile))
 
 	//EnergyQuery
-	r.Handle("/energy_queries/{energy_query_type_name}/", Handler(server.handleDisplayName))
+	r.Handle("/energy_queries/{energy_query_type_name}/", server.handler(server.handleDisplayName))
 
-	r.Handle("/energy_queries/{energy_query_type_name}/{manual_type_name}/", Handler(server.handleDeviceGenericRedirect))
+	r.Handle("/energy_queries/{energy_query_type_name}/{manual_type_name}/", server.handler(server.handleDeviceGenericRedirect))
 
-	r.Handle("/energy_queries/{energy_query_type_name}/{manual_type_name}/{campaign_name}/", languageRedirectWithManufacturerFallback)
+	r.Handle("/energy_queries/{energy_query_type_name}/{manual_type_name}/{campaign_name}/", server.handler(languageRedirectWithManufacturerFallback))
 
-	r.Handle("/energy_queries/{energy_query_type_name}/{manual_type_name}/{campaign_name}/*", http.FileServer(http.FS(server.fsys)))
+	r.Handle("/energy_queries/{energy_query_type_name}/{manual_type_name}/{campaign_name}/*", server.handler(server.handleFile))
 
 	//Cloud_feeds
-	r.Handle("/cloud_feeds/{cloud_feed_type_name}/", Handler(server.handleDisplayName))
+	r.Handle("/cloud_feeds/{cloud_feed_type_name}/", server.handler(server.handleDisplayName))
 
-	r.Handle("/cloud_feeds/{cloud_feed_type_name}/{manual_type_name}/", Handler(server.handleDeviceGenericRedirect))
+	r.Handle("/cloud_feeds/{cloud_feed_type_name}/{manual_type_name}/", server.handler(server.handleDeviceGenericRedirect))
 
-	r.Handle("/cloud_feeds/{cloud_feed_type_name}/{manual_type_name}/{campaign_name}/", languageRedirectWithManufacturerFallback)
+	r.Handle("/cloud_feeds/{cloud_feed_type_name}/{manual_type_name}/{campaign_name}/", server.handler(languageRedirectWithManufacturerFallback))
 
-	r.Handle("/cloud_feeds/{cloud_feed_type_name}/{manual_type_name}/{campaign_name}/*", http.FileServer(http.FS(server.fsys)))
+	r.Handle("/cloud_feeds/{cloud_feed_type_name}/{manual_type_name}/{campaign_name}/*", server.handler(server.handleFile))
+
+	r.NotFound(server.handler(server.handleNotFound).ServeHTTP)
 
 	return server
 }
 
+// Return an http.Handler that sends errors returned by fn to the HTTP client as an error page.
+func (s *Server) handler(fn Handler) http.Handler {
+	return fn.WithErrorWriter(s.writeError)
+}
+
+// Return the filesystem manuals are currently served from.
+func (s *Server) FS() fs.FS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.fsys
+}
+
+// Return the filesystem manuals are currently served from and its generation,
+// which changes every time the filesystem is replaced.
+func (s *Server) current() (fs.FS, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.fsys, s.generation
+}
+
+// Return the filesystem manuals are currently served from and its manifest.
+func (s *Server) currentManifest() (fs.FS, parser.Manifest) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.fsys, s.manifest
+}
+
+// Replace the filesystem manuals are served from.
+//
+// Requests that already started keep using the previous filesystem.
+func (s *Server) SetFS(fsys fs.FS) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fsys = fsys
+	s.manifest = readManifest(fsys)
+	s.generation++
+}
+
+// Handle serving files from the current filesystem.
+//
+// Files in the manifest are served with an ETag and their Last-Modified time from the manifest,
+// and precompressed if the client accepts one of their precompressed variants.
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) error {
+	fsys, manifest := s.currentManifest()
+
+	filePath := strings.Trim(path.Clean(r.URL.Path), "/")
+
+	info, err := fs.Stat(fsys, filePath)
+	if err != nil {
+		return NewHandlerError(err, http.StatusNotFound)
+	}
+
+	// Browsers use the Content-Type of the file, instead of guessing it from its contents.
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if parser.IsHashedAsset(filePath) {
+		// The name changes when the contents change.
+		setCacheControl(w, s.cacheControl().HashedAssets)
+		w.Header().Set("Content-Security-Policy", assetContentSecurityPolicy)
+	} else {
+		setCacheControl(w, s.cacheControl().Files)
+	}
+
+	// A directory is served as its index.html file, once the path ends with a slash.
+	if info.IsDir() && strings.HasSuffix(r.URL.Path, "/") {
+		filePath = path.Join(filePath, "index.html")
+	}
+
+	if file, ok := manifest[filePath]; ok {
+		served, err := servePrecompressedFile(w, r, fsys, manifest, filePath)
+		if served || err != nil {
+			return err
+		}
+
+		return serveManifestFile(w, r, fsys, filePath, file)
+	}
+
+	http.FileServer(http.FS(fsys)).ServeHTTP(w, r)
+	return nil
+}
+
+// Handle requests that do not match any route.
+func (s *Server) handleNotFound(w http.ResponseWriter, r *http.Request) error {
+	return NewHandlerError(fmt.Errorf("no manual at %s", r.URL.Path), http.StatusNotFound)
+}
+
 func (s *Server) handleCampaignGenericRedirect(w http.ResponseWriter, r *http.Request) error {
 	urlPath := strings.Trim(r.URL.Path, "/")
 
@@ -89,19 +233,18 @@ func (s *Server) handleCampaignGenericRedirect(w http.ResponseWriter, r *http.Re
 
 	redirectPath := "/" + path.Join(splitPath...) + "/"
 
-	http.Redirect(w, r, redirectPath, http.StatusFound)
+	s.redirect(w, r, redirectPath)
 	return nil
 }
 
-// Handle serving display_names.json for a requested device.
-func (s *Server) handleDisplayName(w http.ResponseWriter, r *http.Request) error {
-	urlPath := strings.Trim(r.URL.Path, "/")
-
-	file, err := fs.ReadFile(s.fsys, urlPath+"/display_names.json")
+// Handle serving the revisions of the git repositories the manuals were parsed from.
+func (s *Server) handleRevisions(w http.ResponseWriter, r *http.Request) error {
+	file, err := fs.ReadFile(s.FS(), parser.RevisionsFileName)
 	if err != nil {
 		return NewHandlerError(err, http.StatusNotFound)
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(file)
 	return nil
 }
@@ -111,14 +254,17 @@ func (s *Server) handleDeviceGenericRedirect(w http.ResponseWriter, r *http.Requ
 
 	redirectPath := "/" + path.Join(urlPath, genericCampaign) + "/"
 
-	http.Redirect(w, r, redirectPath, http.StatusFound)
+	s.redirect(w, r, redirectPath)
 	return nil
 }
 
-// Handle redirection to correct language based on Accept-Language header.
+// Handle redirection to correct language based on the lang parameter, the language cookie
+// or the Accept-Language header.
 func (s *Server) handleLanguageRedirect(w http.ResponseWriter, r *http.Request) error {
 	urlPath := strings.Trim(r.URL.Path, "/")
-	availableLangs, err := ParseLanguageFiles(s.fsys, urlPath)
+	fsys := s.FS()
+
+	availableLangs, err := ParseLanguageFiles(fsys, urlPath)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return NewHandlerError(err, http.StatusNotFound)
@@ -127,21 +273,33 @@ func (s *Server) handleLanguageRedirect(w http.ResponseWriter, r *http.Request)
 		return NewHandlerError(err, http.StatusInternalServerError)
 	}
 
-	acceptLang := r.Header.Get("Accept-Language")
+	if len(availableLangs) == 0 {
+		return NewHandlerError(fs.ErrNotExist, http.StatusNotFound)
+	}
+
+	lang := s.chooseLanguage(w, fsys, urlPath, availableLangs, s.languagePreferences(r)...)
 
-	lang, err := ChooseFile(availableLangs, s.options.FallbackLanguage, acceptLang)
-	if err != nil {
-		return NewHandlerError(err, http.StatusInternalServerError)
+	redirectPath := "/" + path.Join(urlPath, lang.String()) + "/"
+
+	// The redirect depends on the language of the client, so caches have to store one for each language.
+	w.Header().Add("Vary", "Accept-Language")
+	if s.options.LanguageCookie {
+		w.Header().Add("Vary", "Cookie")
 	}
 
-	redirectPath := "/" + path.Join(urlPath, lang) + "/"
+	if s.setLanguageCookie(w, r) {
+		// A response that sets a cookie must not be shared with other clients.
+		setCacheControl(w, "private, no-cache")
+		http.Redirect(w, r, redirectPath, http.StatusFound)
+		return nil
+	}
 
-	http.Redirect(w, r, redirectPath, http.StatusFound)
+	s.redirect(w, r, redirectPath)
 	return nil
 }
 
 // Middleware that will fallback from 'generic' to 'campaign' when generic was not found.
-func manufacturerFallbackMiddleware(next Handler) Handler {
+func (s *Server) manufacturerFallbackMiddleware(next Handler) Handler {
 	return func(w http.ResponseWriter, r *http.Request) error {
 		err := next(w, r)
 		if err != nil {
@@ -153,10 +311,15 @@ func manufacturerFallbackMiddleware(next Handler) Handler {
 				urlPath := strings.Trim(r.URL.Path, "/")
 
 				splitURLPath := strings.Split(urlPath, "/")
+				if splitURLPath[len(splitURLPath)-1] == manufacturerManual {
+					// There is nothing to fall back to.
+					return err
+				}
 				splitURLPath[len(splitURLPath)-1] = manufacturerManual
 
 				redirectPath := "/" + path.Join(splitURLPath...) + "/"
-				http.Redirect(w, r, redirectPath, http.StatusFound)
+				s.redirect(w, r, redirectPath)
+				return nil
 			}
 
 			return err
@@ -0,0 +1,356 @@
+package needforheatmanualserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"golang.org/x/text/language"
+)
+
+// Create a generation like the parser writes it, with a catalog and a manifest.
+func newTestGeneration(t *testing.T) fstest.MapFS {
+	t.Helper()
+
+	fsys := fstest.MapFS{
+		"campaigns/generic/faq/en-US/index.html":                         {Data: []byte("<h1>FAQ</h1>")},
+		"campaigns/generic/faq/en-US/index.html.br":                      {Data: []byte("brotli FAQ")},
+		"campaigns/generic/faq/en-US/index.html.gz":                      {Data: []byte("gzip FAQ")},
+		"campaigns/generic/faq/nl-NL/index.html":                         {Data: []byte("<h1>Veelgestelde vragen</h1>")},
+		"campaigns/generic/faq/assets/meter.6105d6cc76af4003.png":        {Data: []byte("image")},
+		"devices/smart-meter/display_names.json":                         {Data: []byte(`{"en-US":"Smart meter","nl-NL":"Slimme meter"}`)},
+		"devices/smart-meter/installation/manufacturer/en-US/index.html": {Data: []byte("<h1>Installation</h1>")},
+	}
+
+	catalog := parser.Catalog{
+		Devices: []parser.CatalogEntity{
+			{
+				Name:         "smart-meter",
+				URL:          "/devices/smart-meter/",
+				DisplayNames: map[string]string{"en-US": "Smart meter", "nl-NL": "Slimme meter"},
+			},
+		},
+	}
+
+	data, err := json.Marshal(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys[parser.CatalogFileName] = &fstest.MapFile{Data: data}
+
+	modified := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	manifest := parser.Manifest{}
+	for filePath, file := range fsys {
+		hash := sha256.Sum256(file.Data)
+		manifest[filePath] = parser.ManifestFile{
+			Hash:     hex.EncodeToString(hash[:]),
+			Size:     int64(len(file.Data)),
+			Modified: modified,
+		}
+	}
+
+	data, err = json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys[parser.ManifestFileName] = &fstest.MapFile{Data: data}
+
+	return fsys
+}
+
+func newTestServer(t *testing.T, options ServerOptions) *Server {
+	t.Helper()
+
+	if options.FallbackLanguages == nil {
+		options.FallbackLanguages = []language.Tag{language.MustParse("en-US")}
+	}
+
+	return NewServer(newTestGeneration(t), options)
+}
+
+// Serve a GET request for target with headers and return the response.
+func testGet(server *Server, target string, headers map[string]string) *http.Response {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	return w.Result()
+}
+
+// Return the body of res as a string.
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestServeFileETag(t *testing.T) {
+	server := newTestServer(t, ServerOptions{})
+
+	res := testGet(server, "/campaigns/generic/faq/nl-NL/", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	hash := sha256.Sum256([]byte("<h1>Veelgestelde vragen</h1>"))
+	expected := `"` + hex.EncodeToString(hash[:]) + `"`
+
+	etag := res.Header.Get("ETag")
+	if etag != expected {
+		t.Fatalf("expected strong ETag %s, got %s", expected, etag)
+	}
+
+	res = testGet(server, "/campaigns/generic/faq/nl-NL/", map[string]string{"If-None-Match": etag})
+	if res.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotModified, res.StatusCode)
+	}
+
+	res = testGet(server, "/campaigns/generic/faq/nl-NL/", map[string]string{"If-None-Match": `"other"`})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d for another ETag, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	custom := CacheControl{
+		Redirects:    "public, max-age=60",
+		Files:        "no-store",
+		HashedAssets: "public, max-age=3600",
+	}
+
+	tests := []struct {
+		target   string
+		status   int
+		expected func(CacheControl) string
+	}{
+		{"/campaigns/faq/", http.StatusFound, func(c CacheControl) string { return c.Redirects }},
+		{"/campaigns/generic/faq/", http.StatusFound, func(c CacheControl) string { return c.Redirects }},
+		{"/devices/smart-meter/installation/", http.StatusFound, func(c CacheControl) string { return c.Redirects }},
+		{"/devices/smart-meter/installation/generic/", http.StatusFound, func(c CacheControl) string { return c.Redirects }},
+		{"/campaigns/generic/faq/en-US/", http.StatusOK, func(c CacheControl) string { return c.Files }},
+		{"/campaigns/generic/faq/assets/meter.6105d6cc76af4003.png", http.StatusOK, func(c CacheControl) string { return c.HashedAssets }},
+	}
+
+	for _, cacheControl := range []*CacheControl{nil, &custom} {
+		server := newTestServer(t, ServerOptions{CacheControl: cacheControl})
+
+		expected := DefaultCacheControl
+		if cacheControl != nil {
+			expected = *cacheControl
+		}
+
+		for _, test := range tests {
+			res := testGet(server, test.target, nil)
+			if res.StatusCode != test.status {
+				t.Errorf("%s: expected status code %d, got %d", test.target, test.status, res.StatusCode)
+			}
+
+			if header := res.Header.Get("Cache-Control"); header != test.expected(expected) {
+				t.Errorf("%s: expected Cache-Control %q, got %q", test.target, test.expected(expected), header)
+			}
+		}
+	}
+
+	// Setting the language cookie makes the redirect private.
+	server := newTestServer(t, ServerOptions{LanguageCookie: true})
+
+	res := testGet(server, "/campaigns/generic/faq/?lang=nl-NL", nil)
+	if header := res.Header.Get("Cache-Control"); header != "private, no-cache" {
+		t.Errorf("expected a private redirect when the cookie is set, got Cache-Control %q", header)
+	}
+}
+
+func TestAssetSecurityHeaders(t *testing.T) {
+	server := newTestServer(t, ServerOptions{})
+
+	tests := []struct {
+		target string
+		csp    string
+	}{
+		{"/campaigns/generic/faq/en-US/", ""},
+		{"/campaigns/generic/faq/assets/meter.6105d6cc76af4003.png", assetContentSecurityPolicy},
+	}
+
+	for _, test := range tests {
+		res := testGet(server, test.target, nil)
+
+		if header := res.Header.Get("X-Content-Type-Options"); header != "nosniff" {
+			t.Errorf("%s: expected X-Content-Type-Options nosniff, got %q", test.target, header)
+		}
+
+		if header := res.Header.Get("Content-Security-Policy"); header != test.csp {
+			t.Errorf("%s: expected Content-Security-Policy %q, got %q", test.target, test.csp, header)
+		}
+	}
+}
+
+func TestLanguageRedirectVary(t *testing.T) {
+	tests := []struct {
+		languageCookie bool
+		expected       []string
+	}{
+		{false, []string{"Accept-Language"}},
+		{true, []string{"Accept-Language", "Cookie"}},
+	}
+
+	for _, test := range tests {
+		server := newTestServer(t, ServerOptions{LanguageCookie: test.languageCookie})
+
+		res := testGet(server, "/campaigns/generic/faq/", nil)
+		if res.StatusCode != http.StatusFound {
+			t.Fatalf("expected status code %d, got %d", http.StatusFound, res.StatusCode)
+		}
+
+		vary := res.Header.Values("Vary")
+		if strings.Join(vary, ", ") != strings.Join(test.expected, ", ") {
+			t.Errorf("language cookie %t: expected Vary %v, got %v", test.languageCookie, test.expected, vary)
+		}
+	}
+}
+
+func TestServePrecompressedFile(t *testing.T) {
+	server := newTestServer(t, ServerOptions{})
+
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+		body           string
+	}{
+		{"gzip, deflate, br", "br", "brotli FAQ"},
+		{"gzip", "gzip", "gzip FAQ"},
+		{"br;q=0, gzip", "gzip", "gzip FAQ"},
+		{"", "", "<h1>FAQ</h1>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.acceptEncoding, func(t *testing.T) {
+			res := testGet(server, "/campaigns/generic/faq/en-US/", map[string]string{"Accept-Encoding": test.acceptEncoding})
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, res.StatusCode)
+			}
+
+			if encoding := res.Header.Get("Content-Encoding"); encoding != test.encoding {
+				t.Errorf("expected Content-Encoding %q, got %q", test.encoding, encoding)
+			}
+
+			if body := readBody(t, res); body != test.body {
+				t.Errorf("expected body %q, got %q", test.body, body)
+			}
+
+			if vary := res.Header.Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("expected Vary Accept-Encoding, got %q", vary)
+			}
+
+			if contentType := res.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+				t.Errorf("expected an HTML Content-Type, got %q", contentType)
+			}
+		})
+	}
+
+	// Files without precompressed variants do not vary by encoding.
+	res := testGet(server, "/campaigns/generic/faq/nl-NL/", map[string]string{"Accept-Encoding": "br, gzip"})
+	if res.Header.Get("Content-Encoding") != "" || res.Header.Get("Vary") != "" {
+		t.Errorf("expected an uncompressed response without Vary, got %v", res.Header)
+	}
+}
+
+func TestLanguageRedirectPreferences(t *testing.T) {
+	tests := []struct {
+		name           string
+		languageCookie bool
+		target         string
+		headers        map[string]string
+		expected       string
+		setCookie      string
+	}{
+		{"accept language", true, "/campaigns/generic/faq/", map[string]string{"Accept-Language": "nl-BE,nl;q=0.9"}, "nl-NL", ""},
+		{"fallback", true, "/campaigns/generic/faq/", map[string]string{"Accept-Language": "fr-FR"}, "en-US", ""},
+		{"cookie", true, "/campaigns/generic/faq/", map[string]string{"Accept-Language": "en-US", "Cookie": "nfh_lang=nl-NL"}, "nl-NL", ""},
+		{"cookie disabled", false, "/campaigns/generic/faq/", map[string]string{"Accept-Language": "en-US", "Cookie": "nfh_lang=nl-NL"}, "en-US", ""},
+		{"lang parameter", true, "/campaigns/generic/faq/?lang=nl-nl", map[string]string{"Accept-Language": "en-US", "Cookie": "nfh_lang=en-US"}, "nl-NL", "nl-NL"},
+		{"lang parameter without cookie", false, "/campaigns/generic/faq/?lang=nl-NL", map[string]string{"Accept-Language": "en-US"}, "nl-NL", ""},
+		{"invalid lang parameter", true, "/campaigns/generic/faq/?lang=%21%21", map[string]string{"Cookie": "nfh_lang=nl-NL"}, "nl-NL", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, ServerOptions{LanguageCookie: test.languageCookie})
+
+			res := testGet(server, test.target, test.headers)
+			if res.StatusCode != http.StatusFound {
+				t.Fatalf("expected status code %d, got %d", http.StatusFound, res.StatusCode)
+			}
+
+			expected := "/campaigns/generic/faq/" + test.expected + "/"
+			if location := res.Header.Get("Location"); !strings.HasPrefix(location, expected) {
+				t.Errorf("expected a redirect to %s, got %s", expected, location)
+			}
+
+			setCookie := ""
+			for _, cookie := range res.Cookies() {
+				if cookie.Name == languageCookieName {
+					setCookie = cookie.Value
+				}
+			}
+			if setCookie != test.setCookie {
+				t.Errorf("expected language cookie %q, got %q", test.setCookie, setCookie)
+			}
+		})
+	}
+}
+
+func TestDisplayNames(t *testing.T) {
+	server := newTestServer(t, ServerOptions{LanguageCookie: true})
+
+	tests := []struct {
+		target   string
+		headers  map[string]string
+		status   int
+		expected string
+	}{
+		{"/devices/smart-meter/", nil, http.StatusOK, `{"en-US":"Smart meter","nl-NL":"Slimme meter"}`},
+		{"/devices/smart-meter/?lang=nl-NL", nil, http.StatusOK, `{"language":"nl-NL","display_name":"Slimme meter"}`},
+		{"/devices/smart-meter/?lang=nl", nil, http.StatusOK, `{"language":"nl-NL","display_name":"Slimme meter"}`},
+		{"/devices/smart-meter/?lang=fr-FR", nil, http.StatusOK, `{"language":"en-US","display_name":"Smart meter"}`},
+		{"/devices/smart-meter/?lang", map[string]string{"Accept-Language": "nl-NL"}, http.StatusOK, `{"language":"nl-NL","display_name":"Slimme meter"}`},
+		{"/devices/smart-meter/?lang", map[string]string{"Accept-Language": "en-US", "Cookie": "nfh_lang=nl-NL"}, http.StatusOK, `{"language":"nl-NL","display_name":"Slimme meter"}`},
+		{"/devices/unknown/", nil, http.StatusNotFound, ""},
+		{"/api/v1/display_names/", nil, http.StatusOK, `{"devices":{"smart-meter":{"en-US":"Smart meter","nl-NL":"Slimme meter"}},"energy_queries":{},"cloud_feeds":{}}`},
+		{"/api/v1/display_names/?lang=nl-NL", nil, http.StatusOK, `{"devices":{"smart-meter":{"language":"nl-NL","display_name":"Slimme meter"}},"energy_queries":{},"cloud_feeds":{}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			res := testGet(server, test.target, test.headers)
+			if res.StatusCode != test.status {
+				t.Fatalf("expected status code %d, got %d", test.status, res.StatusCode)
+			}
+
+			if test.expected == "" {
+				return
+			}
+
+			body := strings.TrimSpace(readBody(t, res))
+			if body != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, body)
+			}
+		})
+	}
+}
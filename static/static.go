@@ -0,0 +1,296 @@
+// Package static exports parsed manuals as a static site that can be hosted without the server.
+//
+// The server negotiates the language of a manual and falls back to the generic campaign and the
+// manufacturer manual using redirects. A static host cannot do this, so an index.html redirect stub
+// is written for every URL the server would redirect from.
+package static
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"github.com/energietransitie/needforheat-manual-server/wfs"
+	"golang.org/x/text/language"
+)
+
+const (
+	genericCampaign    string = "generic"
+	manufacturerManual string = "manufacturer"
+
+	redirectFileName string = "index.html"
+)
+
+// Template for a redirect stub.
+//
+// When Languages is set, the stub picks a language for the lang parameter, the language cookie
+// and the browser's languages, in that order: the first of them that is available, or else has an available language
+// with the same base language (e.g. 'nl-BE' for 'nl-NL'), is used. Languages[0] is the fallback language.
+// A valid lang parameter is stored in the language cookie in its canonical form, like the server does.
+// Otherwise it redirects to Target. Without JavaScript, it redirects to Target using a meta refresh.
+var redirectTemplate = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="robots" content="noindex">
+    <title>Redirecting…</title>
+    <script>
+        (function () {
+            var target = {{.Target}};
+            var languages = {{.Languages}};
+            if (languages && languages.length > 0) {
+                target = languages[0] + "/";
+                var canonical = function (lang) {
+                    try {
+                        return Intl.getCanonicalLocales(lang.replace(/_/g, "-"))[0];
+                    } catch (e) {
+                        return undefined;
+                    }
+                };
+                var base = function (lang) {
+                    return lang.toLowerCase().split("-")[0];
+                };
+                var preferred = (navigator.languages || [navigator.language || ""]).slice();
+                var cookie = document.cookie.match(/(?:^|; )nfh_lang=([^;]*)/);
+                var requested = canonical(new URLSearchParams(window.location.search).get("lang") || "");
+                if (requested) {
+                    document.cookie = "nfh_lang=" + encodeURIComponent(requested) + "; path=/; max-age=31536000; samesite=lax";
+                    preferred.unshift(requested);
+                } else if (cookie) {
+                    preferred.unshift(decodeURIComponent(cookie[1]));
+                }
+                var choose = function () {
+                    for (var i = 0; i < preferred.length; i++) {
+                        var lang = preferred[i].toLowerCase();
+                        for (var j = 0; j < languages.length; j++) {
+                            if (lang === languages[j].toLowerCase()) {
+                                return languages[j];
+                            }
+                        }
+                        for (var k = 0; k < languages.length; k++) {
+                            if (base(lang) === base(languages[k])) {
+                                return languages[k];
+                            }
+                        }
+                    }
+                };
+                var lang = choose();
+                if (lang) {
+                    target = lang + "/";
+                }
+            }
+            window.location.replace(target + window.location.search + window.location.hash);
+        })();
+    </script>
+    <noscript><meta http-equiv="refresh" content="0; url={{.Target}}"></noscript>
+</head>
+<body>
+    <a href="{{.Target}}">{{.Target}}</a>
+</body>
+</html>
+`))
+
+type redirectStub struct {
+	// Relative URL to redirect to.
+	Target string
+
+	// Languages to choose from. The first one is the fallback language.
+	Languages []string
+}
+
+// Export the parsed manuals in site to dest, which has to be a writable filesystem,
+// and add redirect stubs based on the catalog in site.
+//
+// fallbacks are the languages used, in order, when none of the browser's languages is available.
+// The fallback languages of a campaign in its fallback_languages.json file are preferred for its manuals.
+func Export(dest fs.FS, site fs.FS, fallbacks []language.Tag) error {
+	err := copyFS(dest, site)
+	if err != nil {
+		return err
+	}
+
+	data, err := fs.ReadFile(site, parser.CatalogFileName)
+	if err != nil {
+		return err
+	}
+
+	var catalog parser.Catalog
+	err = json.Unmarshal(data, &catalog)
+	if err != nil {
+		return err
+	}
+
+	return WriteRedirects(dest, catalog, fallbacks)
+}
+
+// Write redirect stubs to fsys for all manuals in catalog.
+//
+// Redirect stubs are written for:
+//   - every manual, to the language that best matches the browser.
+//   - every manual type of an entity, to the generic campaign or the manufacturer manual if there is no generic one.
+//   - every known campaign that has no manual for a manual type of an entity, to the manufacturer manual.
+//   - every manual type of the generic campaign, from /campaigns/<manual_type>/.
+//
+// The fallback languages of campaigns are read from fsys.
+func WriteRedirects(fsys fs.FS, catalog parser.Catalog, fallbacks []language.Tag) error {
+	for url, stub := range redirectStubs(fsys, catalog, fallbacks) {
+		err := writeRedirect(fsys, url, stub)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return the redirect stubs for all manuals in catalog by URL.
+func redirectStubs(fsys fs.FS, catalog parser.Catalog, fallbacks []language.Tag) map[string]redirectStub {
+	stubs := map[string]redirectStub{}
+
+	campaignNames := map[string]bool{genericCampaign: true}
+	for _, campaign := range catalog.Campaigns {
+		campaignNames[campaign.Name] = true
+	}
+
+	var entities []parser.CatalogEntity
+	entities = append(entities, catalog.Devices...)
+	entities = append(entities, catalog.EnergyQueries...)
+	entities = append(entities, catalog.CloudFeeds...)
+
+	for _, entity := range entities {
+		for _, manualType := range entity.ManualTypes {
+			for _, manual := range manualType.Campaigns {
+				if manual.Name != manufacturerManual {
+					campaignNames[manual.Name] = true
+				}
+			}
+		}
+	}
+
+	for _, entity := range entities {
+		for _, manualType := range entity.ManualTypes {
+			campaigns := map[string]bool{}
+			for _, manual := range manualType.Campaigns {
+				campaigns[manual.Name] = true
+				stubs[manual.URL] = languageStub(manual, campaignFallbacks(fsys, manual.Name, fallbacks))
+			}
+
+			if campaigns[genericCampaign] {
+				stubs[manualType.URL] = redirectStub{Target: genericCampaign + "/"}
+			} else if campaigns[manufacturerManual] {
+				stubs[manualType.URL] = redirectStub{Target: manufacturerManual + "/"}
+			}
+
+			if !campaigns[manufacturerManual] {
+				continue
+			}
+
+			for campaignName := range campaignNames {
+				if !campaigns[campaignName] {
+					stubs[manualType.URL+campaignName+"/"] = redirectStub{Target: "../" + manufacturerManual + "/"}
+				}
+			}
+		}
+	}
+
+	for _, campaign := range catalog.Campaigns {
+		for _, manual := range campaign.ManualTypes {
+			stubs[manual.URL] = languageStub(manual, campaignFallbacks(fsys, campaign.Name, fallbacks))
+
+			if campaign.Name == genericCampaign && !campaignNames[manual.Name] {
+				stubs["/campaigns/"+manual.Name+"/"] = redirectStub{Target: "../" + genericCampaign + "/" + manual.Name + "/"}
+			}
+		}
+	}
+
+	return stubs
+}
+
+// Return the fallback languages of campaign in fsys, followed by fallbacks.
+func campaignFallbacks(fsys fs.FS, campaign string, fallbacks []language.Tag) []language.Tag {
+	campaignFallbacks, err := parser.CampaignFallbackLanguages(fsys, campaign)
+	if err != nil {
+		log.Println("error reading fallback languages:", err)
+	}
+
+	return append(campaignFallbacks, fallbacks...)
+}
+
+// Return a redirect stub that chooses one of the languages of manual.
+// The languages are sorted with parser.SortLanguages, so the first one is the fallback language.
+func languageStub(manual parser.CatalogManual, fallbacks []language.Tag) redirectStub {
+	tags := make([]language.Tag, 0, len(manual.Languages))
+	for _, lang := range manual.Languages {
+		tags = append(tags, language.Make(lang.Language))
+	}
+
+	var languages []string
+	for _, tag := range parser.SortLanguages(tags, fallbacks) {
+		languages = append(languages, tag.String())
+	}
+
+	stub := redirectStub{Languages: languages}
+	if len(languages) > 0 {
+		stub.Target = languages[0] + "/"
+	}
+
+	return stub
+}
+
+// Write stub to the index.html file in the directory for url.
+func writeRedirect(fsys fs.FS, url string, stub redirectStub) error {
+	dirPath := strings.Trim(url, "/")
+
+	err := wfs.MkdirAll(fsys, dirPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = redirectTemplate.Execute(&buf, stub)
+	if err != nil {
+		return err
+	}
+
+	return wfs.WriteFile(fsys, path.Join(dirPath, redirectFileName), buf.Bytes(), 0644)
+}
+
+// Copy all files and directories in src to dest.
+//
+// The build report is not copied, because it is only available to admins.
+func copyFS(dest fs.FS, src fs.FS) error {
+	return fs.WalkDir(src, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if filePath == parser.BuildReportFileName {
+			return nil
+		}
+
+		if d.IsDir() {
+			return wfs.MkdirAll(dest, filePath, 0755)
+		}
+
+		srcFile, err := src.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+
+		destFile, err := wfs.CreateFile(dest, filePath)
+		if err != nil {
+			return err
+		}
+		defer destFile.Close()
+
+		_, err = io.Copy(destFile, srcFile)
+		return err
+	})
+}
@@ -0,0 +1,59 @@
+package static
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/energietransitie/needforheat-manual-server/parser"
+	"golang.org/x/text/language"
+)
+
+func TestRedirectStubs(t *testing.T) {
+	languages := []parser.CatalogLanguage{{Language: "en-US"}, {Language: "nl-NL"}}
+
+	catalog := parser.Catalog{
+		Devices: []parser.CatalogEntity{
+			{
+				Name: "smart-meter",
+				ManualTypes: []parser.CatalogManualType{
+					{
+						Name: "installation",
+						URL:  "/devices/smart-meter/installation/",
+						Campaigns: []parser.CatalogManual{
+							{Name: "manufacturer", URL: "/devices/smart-meter/installation/manufacturer/", Languages: languages},
+							{Name: "winter", URL: "/devices/smart-meter/installation/winter/", Languages: languages},
+						},
+					},
+				},
+			},
+		},
+		Campaigns: []parser.CatalogCampaign{
+			{
+				Name: "generic",
+				ManualTypes: []parser.CatalogManual{
+					{Name: "faq", URL: "/campaigns/generic/faq/", Languages: languages},
+				},
+			},
+		},
+	}
+
+	expected := map[string]redirectStub{
+		"/devices/smart-meter/installation/":              {Target: "manufacturer/"},
+		"/devices/smart-meter/installation/generic/":      {Target: "../manufacturer/"},
+		"/devices/smart-meter/installation/manufacturer/": {Target: "nl-NL/", Languages: []string{"nl-NL", "en-US"}},
+		"/devices/smart-meter/installation/winter/":       {Target: "en-US/", Languages: []string{"en-US", "nl-NL"}},
+		"/campaigns/generic/faq/":                         {Target: "nl-NL/", Languages: []string{"nl-NL", "en-US"}},
+		"/campaigns/faq/":                                 {Target: "../generic/faq/"},
+	}
+
+	// The winter campaign prefers English.
+	fsys := fstest.MapFS{
+		"campaigns/winter/fallback_languages.json": {Data: []byte(`["en-US"]`)},
+	}
+
+	stubs := redirectStubs(fsys, catalog, []language.Tag{language.MustParse("nl-NL")})
+	if !reflect.DeepEqual(stubs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, stubs)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/energietransitie/needforheat-manual-server/wfs"
 )
@@ -118,12 +119,19 @@ func (dir DirFS) MkdirAll(path string, perm fs.FileMode) error {
 // If dir is the empty string, MkdirTemp returns an error.
 // Multiple programs or goroutines calling MkdirTemp simultaneously will not choose the same directory.
 // It is the caller's responsibility to remove the directory when it is no longer needed.
-func (dir DirFS) MkdirTemp(path string, pattern string) (string, error) {
-	fullPath, err := dir.join(path)
+func (dir DirFS) MkdirTemp(dirPath string, pattern string) (string, error) {
+	fullPath, err := dir.join(dirPath)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := os.MkdirTemp(fullPath, pattern)
 	if err != nil {
 		return "", err
 	}
-	return os.MkdirTemp(fullPath, pattern)
+
+	// Return the path inside the filesystem, not on disk.
+	return path.Join(dirPath, filepath.Base(name)), nil
 }
 
 // Remove removes the named file or (empty) directory.
@@ -149,6 +157,31 @@ func (dir DirFS) RemoveAll(path string) error {
 	return os.RemoveAll(fullPath)
 }
 
+// Rename renames (moves) oldpath to newpath.
+// If newpath already exists and is not a directory, Rename replaces it.
+// If there is an error, it will be of type *LinkError.
+func (dir DirFS) Rename(oldpath, newpath string) error {
+	fullOldPath, err := dir.join(oldpath)
+	if err != nil {
+		return err
+	}
+	fullNewPath, err := dir.join(newpath)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fullOldPath, fullNewPath)
+}
+
+// Sub returns a DirFS corresponding to the subtree rooted at dir.
+// Unlike the filesystem returned by fs.Sub for other filesystems, it can be written to.
+func (dir DirFS) Sub(name string) (fs.FS, error) {
+	fullPath, err := dir.join(name)
+	if err != nil {
+		return nil, err
+	}
+	return DirFS(fullPath), nil
+}
+
 // join returns the path for name in wfs.
 func (dir DirFS) join(name string) (string, error) {
 	if dir == "" {
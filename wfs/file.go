@@ -77,3 +77,24 @@ func Remove(fsys fs.FS, name string) error {
 	}
 	return &fs.PathError{Op: "remove", Path: name, Err: ErrInterfaceNotImplemented}
 }
+
+// RenameFS is the interface implemented by a file system
+// that provides an implementation of Rename.
+type RenameFS interface {
+	fs.FS
+
+	// Rename renames (moves) oldpath to newpath.
+	// If newpath already exists and is not a directory, Rename replaces it.
+	// If there is an error, it will be of type *LinkError.
+	Rename(oldpath, newpath string) error
+}
+
+// Rename renames (moves) oldpath to newpath.
+// If newpath already exists and is not a directory, Rename replaces it.
+// If there is an error, it will be of type *LinkError or *PathError.
+func Rename(fsys fs.FS, oldpath, newpath string) error {
+	if fsys, ok := fsys.(RenameFS); ok {
+		return fsys.Rename(oldpath, newpath)
+	}
+	return &fs.PathError{Op: "rename", Path: oldpath, Err: ErrInterfaceNotImplemented}
+}
@@ -21,4 +21,5 @@ type WFS interface {
 	WriteFileFS
 	RemoveFS
 	RemoveAllFS
+	RenameFS
 }